@@ -0,0 +1,69 @@
+package confy
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// AdminOption configures the handler returned by NewAdminHandler.
+type AdminOption func(a *adminHandler)
+
+type adminHandler struct {
+	history HistoryReporter
+}
+
+// WithAdminHistory serves the history of documents at /history (see NewAdminHandler).
+// It is not served by default, since it reveals when secrets changed, and the values of
+// fields marked with WithNonSecretFields.
+func WithAdminHistory(h HistoryReporter) AdminOption {
+	return func(a *adminHandler) {
+		a.history = h
+	}
+}
+
+// NewAdminHandler returns an HTTP handler exposing the state of a client for operators:
+//   - GET /documents lists the hash, version and load times of every loaded document
+//     (see DocumentInfo). `confy fleet-check` compares it across replicas.
+//   - GET /history lists the last versions of every document seen, with redacted diffs
+//     (see HistoryReporter), and GET /history?path=search/app those of a single
+//     document. It is only served with WithAdminHistory.
+//
+// Secret values are never exposed. Mount it with a prefix through http.StripPrefix,
+// e.g. mux.Handle("/confy/", http.StripPrefix("/confy", confy.NewAdminHandler(c))).
+func NewAdminHandler(r DocumentReporter, opts ...AdminOption) http.Handler {
+	a := &adminHandler{}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/documents", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeAdminJSON(w, r.Documents())
+	})
+	if h := a.history; h != nil {
+		mux.HandleFunc("/history", func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			if path := req.URL.Query().Get("path"); path != "" {
+				writeAdminJSON(w, h.History(path))
+				return
+			}
+			writeAdminJSON(w, h.Histories())
+		})
+	}
+
+	return mux
+}
+
+func writeAdminJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,38 @@
+package confy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminDocuments(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"test/app": {"user": "fake-user"},
+		"test/v2":  {"data": map[string]any{"a": "b"}, "metadata": map[string]any{"version": 3}},
+	})
+	config := New(fake.client(t), time.Minute, false, WithDocumentHashKey([]byte("fleet-key")))
+	defer config.Close()
+
+	for _, path := range []string{"test/app", "test/v2"} {
+		if _, err := config.Get(context.Background(), path); err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	NewAdminHandler(config.(DocumentReporter)).ServeHTTP(rec, httptest.NewRequest("GET", "/documents", nil))
+
+	var docs []DocumentInfo
+	if err := json.NewDecoder(rec.Body).Decode(&docs); err != nil {
+		t.Fatalf("could not decode response: %s", err)
+	}
+	if len(docs) != 2 || docs[0].Path != "test/app" || docs[0].Hash != keyedHash([]byte("fleet-key"), map[string]any{"user": "fake-user"}) {
+		t.Fatalf("unexpected documents: %+v", docs)
+	}
+	if docs[1].Version != 3 || docs[1].Generation != 1 {
+		t.Fatalf("expected the KV v2 version to be reported; got %+v", docs[1])
+	}
+}
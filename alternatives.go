@@ -0,0 +1,58 @@
+package confy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// alternativeSeparator separates the alternative paths of a Get path.
+const alternativeSeparator = "||"
+
+// FirstOf returns a path that Get, GetOrDefault and Watch resolve to the first of paths
+// that is found, in order, as in "newsvc/app#user||legacy/app#user":
+//
+//	v, err := c.Get(ctx, confy.FirstOf("newsvc/app#user", "legacy/app#user"))
+//
+// Only paths that are not found, or not in the snapshot of a frozen client (see Freezer),
+// are skipped; any other error is returned right away. The provenance of the value
+// records the path it was read from, and watches switch to a path as soon as it is the
+// first one found. Interceptors and environment overrides see each path on its own.
+func FirstOf(paths ...string) string {
+	return strings.Join(paths, alternativeSeparator)
+}
+
+// alternatives splits path into the paths it is made of (see FirstOf).
+func alternatives(path string) []string {
+	paths := strings.Split(path, alternativeSeparator)
+	for i, p := range paths {
+		paths[i] = strings.TrimSpace(p)
+	}
+
+	return paths
+}
+
+// getFirst reads the first of the alternative paths that is found.
+func (c *confyImpl) getFirst(ctx context.Context, paths []string) (Value, error) {
+	var err error
+	for _, path := range paths {
+		var v Value
+		v, err = c.invoke(ctx, strings.TrimPrefix(path, "secret/"))
+		if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrNotInSnapshot) {
+			return v, err
+		}
+	}
+
+	return nil, fmt.Errorf("none of the paths '%s' was found: %w", strings.Join(paths, "', '"), err)
+}
+
+// documentPaths returns the paths of the documents that path refers to, for each of its alternatives.
+func documentPaths(path string) []string {
+	paths := alternatives(path)
+	for i, p := range paths {
+		paths[i] = documentPath(p)
+	}
+
+	return paths
+}
@@ -0,0 +1,56 @@
+package confy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAlternativePaths(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"legacy/app": {"user": "old"},
+		"other/app":  {"user": "other"},
+	})
+	c := new(fake.client(t), 100*time.Millisecond, false)
+	defer c.Close()
+	ctx := context.Background()
+
+	path := FirstOf("newsvc/app#user", "secret/legacy/app#user", "other/app#user")
+	if path != "newsvc/app#user||secret/legacy/app#user||other/app#user" {
+		t.Fatalf("unexpected path: %s", path)
+	}
+	v, err := c.Get(ctx, path)
+	if err != nil || v.String() != "old" || v.Provenance().Path != "legacy/app#user" {
+		t.Fatalf("expected the legacy path to win; got %v (%+v), %v", v, v.Provenance(), err)
+	}
+	if v, err := c.Get(ctx, "newsvc/app#user || other/app#user"); err != nil || v.String() != "other" {
+		t.Fatalf("expected spaces around the separator to be ignored; got %v, %v", v, err)
+	}
+	if _, err := c.Get(ctx, "newsvc/app#user||legacy/app#missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a not found error; got %v", err)
+	}
+	if v, err := Prefixed(c, "legacy").Get(ctx, "nope#user||app#user"); err != nil || v.String() != "old" {
+		t.Fatalf("expected the prefix to apply to every path; got %v, %v", v, err)
+	}
+
+	// The watch switches over once the new path exists.
+	changed := make(chan Value, 1)
+	cancel := c.Watch(path, func(oldVal, newVal Value) bool {
+		return oldVal.String() != newVal.String()
+	}, func(v Value) {
+		changed <- v
+	})
+	defer cancel()
+	time.Sleep(100 * time.Millisecond)
+	fake.put("newsvc/app", map[string]any{"user": "new"})
+
+	select {
+	case v := <-changed:
+		if v.String() != "new" || v.Provenance().Path != "newsvc/app#user" {
+			t.Fatalf("expected the new path to win; got %v (%+v)", v, v.Provenance())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the watch to switch paths")
+	}
+}
@@ -0,0 +1,329 @@
+package confy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bank-vaults/vault-sdk/vault"
+	"github.com/fsnotify/fsnotify"
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// DefaultServiceAccountTokenPath is where Kubernetes mounts the service account token,
+// and where jwt logins read it from unless VAULT_JWT_FILE says otherwise.
+const DefaultServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+const (
+	loginMinBackoff = time.Second
+	loginMaxBackoff = time.Minute
+
+	// pendingLoginToken is given to the sdk in place of a Vault token until the first
+	// jwt login completes.
+	pendingLoginToken = "confy-pending-login"
+)
+
+var (
+	// ErrServiceAccountTokenMissing is returned (wrapped) when the service account token
+	// used for jwt logins cannot be found.
+	ErrServiceAccountTokenMissing = errors.New("service account token is missing")
+	// ErrServiceAccountTokenExpired is returned (wrapped) when the service account token
+	// used for jwt logins has expired, e.g. because the kubelet stopped rotating it.
+	ErrServiceAccountTokenExpired = errors.New("service account token has expired")
+)
+
+// jwtLogins holds the logins started by NewVaultClient, by client, so that the clients
+// created with New can report their failures and stop them on Close. The sdk client has
+// no hook to stop them when it is closed, and New only receives the sdk client, hence
+// this registry; see NewVaultClient for what it means for the lifetime of a login.
+var jwtLogins sync.Map
+
+// jwtLogin logs in to Vault with the JWT/Kubernetes auth method. The service account token
+// is read again on every login, since projected tokens rotate; a login also happens as soon
+// as the token file changes, and before the Vault token expires.
+type jwtLogin struct {
+	raw      *vaultapi.Client
+	file     string
+	role     string
+	authPath string
+	done     chan struct{}
+	stopOnce sync.Once
+
+	mu      sync.Mutex
+	logger  vault.Logger
+	lastJWT string
+	lastErr error
+}
+
+func newJWTLogin(raw *vaultapi.Client, file, role, authPath string) *jwtLogin {
+	if role == "" {
+		role = "default"
+	}
+	if authPath == "" {
+		authPath = "kubernetes"
+	}
+
+	return &jwtLogin{raw: raw, file: file, role: role, authPath: authPath, done: make(chan struct{}), logger: noopLogger{}}
+}
+
+// serviceAccountTokenPath returns the path jwt logins read the service account token from.
+// It honors the same environment variables as the vault sdk.
+func serviceAccountTokenPath() string {
+	if file := os.Getenv("KUBERNETES_SERVICE_ACCOUNT_TOKEN"); file != "" {
+		return file
+	}
+	if file := os.Getenv("VAULT_JWT_FILE"); file != "" {
+		return file
+	}
+
+	return DefaultServiceAccountTokenPath
+}
+
+// readServiceAccountToken reads the token at file, and checks that it has not expired.
+func readServiceAccountToken(file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w at '%s'; is the token volume mounted?", ErrServiceAccountTokenMissing, file)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not read service account token: %w", err)
+	}
+
+	jwt := strings.TrimSpace(string(content))
+	if jwt == "" {
+		return "", fmt.Errorf("%w: '%s' is empty", ErrServiceAccountTokenMissing, file)
+	}
+	if exp, ok := jwtExpiry(jwt); ok && time.Now().After(exp) {
+		return "", fmt.Errorf("%w: the token in '%s' expired at %s", ErrServiceAccountTokenExpired, file, exp.Format(time.RFC3339))
+	}
+
+	return jwt, nil
+}
+
+// jwtExpiry returns the exp claim of jwt, without verifying it.
+func jwtExpiry(jwt string) (time.Time, bool) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(claims.Exp, 0), true
+}
+
+// login reads the service account token and exchanges it for a Vault token, which the
+// raw client uses from then on. It returns the TTL of the Vault token.
+func (l *jwtLogin) login() (time.Duration, error) {
+	ttl, err := l.doLogin()
+	l.mu.Lock()
+	l.lastErr = err
+	l.mu.Unlock()
+
+	return ttl, err
+}
+
+// loginWithin retries the first login until timeout, since Vault or the token volume may
+// not be ready yet when the pod starts. It returns the last error if none succeeded.
+func (l *jwtLogin) loginWithin(timeout time.Duration) (time.Duration, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		ttl, err := l.login()
+		if err == nil || time.Now().Add(loginMinBackoff).After(deadline) {
+			return ttl, err
+		}
+		time.Sleep(loginMinBackoff)
+	}
+}
+
+// clientTimeout returns how long NewVaultClient waits for the first login, which is
+// the request timeout of the vault sdk.
+func clientTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("VAULT_CLIENT_TIMEOUT")); err == nil {
+		return d
+	}
+
+	return 10 * time.Second
+}
+
+func (l *jwtLogin) doLogin() (time.Duration, error) {
+	jwt, err := readServiceAccountToken(l.file)
+	if err != nil {
+		return 0, err
+	}
+
+	secret, err := l.raw.Logical().Write(fmt.Sprintf("auth/%s/login", l.authPath), map[string]any{"jwt": jwt, "role": l.role})
+	var respErr *vaultapi.ResponseError
+	if errors.As(err, &respErr) && (respErr.StatusCode == http.StatusForbidden || respErr.StatusCode == http.StatusBadRequest) {
+		return 0, fmt.Errorf("vault rejected the service account token in '%s' for role '%s' on auth/%s; "+
+			"check the role's bound service accounts, namespaces and audience: %w", l.file, l.role, l.authPath, err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not log in to Vault: %w", err)
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return 0, errors.New("could not log in to Vault: no token in the response")
+	}
+
+	l.raw.SetToken(secret.Auth.ClientToken)
+	l.mu.Lock()
+	l.lastJWT = jwt
+	l.mu.Unlock()
+
+	return time.Duration(secret.Auth.LeaseDuration) * time.Second, nil
+}
+
+// err returns why the last login failed, or nil if it succeeded.
+func (l *jwtLogin) err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastErr
+}
+
+func (l *jwtLogin) setLogger(logger vault.Logger) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logger = logger
+}
+
+func (l *jwtLogin) log() vault.Logger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.logger
+}
+
+func (l *jwtLogin) stop() {
+	l.stopOnce.Do(func() { close(l.done) })
+}
+
+// start logs in again once two thirds of the Vault token's TTL have passed, or as soon as
+// the service account token changes, until stopped. Failed logins are retried with an
+// exponential backoff.
+func (l *jwtLogin) start(ttl time.Duration) {
+	go l.run(ttl, l.watchFile())
+}
+
+func (l *jwtLogin) run(ttl time.Duration, changed <-chan struct{}) {
+	backoff := loginMinBackoff
+	for {
+		var renew <-chan time.Time
+		if ttl > 0 {
+			renew = time.After(ttl * 2 / 3)
+		}
+
+		select {
+		case <-l.done:
+			return
+		case <-renew:
+		case <-changed:
+			if !l.tokenChanged() {
+				continue
+			}
+			l.log().Info("service account token changed; logging in to Vault again", map[string]any{"file": l.file})
+		}
+
+		newTTL, err := l.login()
+		if err != nil {
+			l.log().Error("could not log in to Vault", map[string]any{"err": err, "retry_in": backoff.String()})
+			ttl = backoff * 3 / 2
+			if backoff *= 2; backoff > loginMaxBackoff {
+				backoff = loginMaxBackoff
+			}
+			continue
+		}
+		l.log().Info("logged in to Vault", map[string]any{"role": l.role, "path": l.authPath, "ttl": newTTL.String()})
+		ttl, backoff = newTTL, loginMinBackoff
+	}
+}
+
+// tokenChanged reports whether the service account token differs from the one used for
+// the last successful login.
+func (l *jwtLogin) tokenChanged() bool {
+	content, err := os.ReadFile(l.file)
+	if err != nil {
+		return true
+	}
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 {
+		// The file is being rewritten in place; wait for the write that fills it.
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !bytes.Equal(content, []byte(l.lastJWT))
+}
+
+// watchFile returns a channel that receives a signal when the service account token
+// file changes. The parent directory is watched, since Kubernetes replaces projected
+// tokens by swapping the ..data symlink next to them.
+func (l *jwtLogin) watchFile() <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = watcher.Add(filepath.Dir(l.file))
+	}
+	if err != nil {
+		l.log().Warn("cannot watch the service account token; it is only read again before the Vault token expires",
+			map[string]any{"file": l.file, "err": err})
+		if watcher != nil {
+			_ = watcher.Close()
+		}
+		return changed
+	}
+
+	file := filepath.Clean(l.file)
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-l.done:
+				return
+			case event := <-watcher.Events:
+				if filepath.Clean(event.Name) != file && filepath.Base(event.Name) != "..data" {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			case err := <-watcher.Errors:
+				l.log().Warn("error watching the service account token", map[string]any{"file": l.file, "err": err})
+			}
+		}
+	}()
+
+	return changed
+}
+
+// loginError adds why logging in to Vault is failing to err, if the client's login
+// was started by NewVaultClient and its last attempt failed.
+func (c *confyImpl) loginError(err error) error {
+	l, ok := jwtLogins.Load(c.client)
+	if !ok {
+		return err
+	}
+	if loginErr := l.(*jwtLogin).err(); loginErr != nil {
+		return fmt.Errorf("%w (logging in to Vault is failing: %w)", err, loginErr)
+	}
+
+	return err
+}
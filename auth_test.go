@@ -0,0 +1,151 @@
+package confy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeJWT returns an unsigned JWT with the given subject and expiry.
+func fakeJWT(sub string, exp time.Time) string {
+	enc := base64.RawURLEncoding
+	payload, _ := json.Marshal(map[string]any{"sub": sub, "exp": exp.Unix()})
+	return enc.EncodeToString([]byte(`{"alg":"RS256"}`)) + "." + enc.EncodeToString(payload) + ".sig"
+}
+
+func TestReadServiceAccountToken(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "token")
+
+	if _, err := readServiceAccountToken(file); !errors.Is(err, ErrServiceAccountTokenMissing) {
+		t.Fatalf("expected a missing token error; got %v", err)
+	}
+
+	_ = os.WriteFile(file, []byte(fakeJWT("old", time.Now().Add(-time.Minute))), 0o600)
+	if _, err := readServiceAccountToken(file); !errors.Is(err, ErrServiceAccountTokenExpired) {
+		t.Fatalf("expected an expired token error; got %v", err)
+	}
+
+	valid := fakeJWT("new", time.Now().Add(time.Hour))
+	_ = os.WriteFile(file, []byte(valid+"\n"), 0o600)
+	if jwt, err := readServiceAccountToken(file); err != nil || jwt != valid {
+		t.Fatalf("expected the token to be read; got %q, %v", jwt, err)
+	}
+}
+
+func TestJWTLogin(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{"test/app": {"user": "fake-user"}})
+	var mu sync.Mutex
+	logins := []string{}
+	reject := false
+	fake.handle("/v1/auth/kubernetes/login", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		defer mu.Unlock()
+		if reject || body["role"] != "app" {
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(w, map[string]any{"errors": []string{"permission denied"}})
+			return
+		}
+		logins = append(logins, body["jwt"].(string))
+		writeJSON(w, map[string]any{"auth": map[string]any{
+			"client_token":   fmt.Sprintf("token-%d", len(logins)),
+			"lease_duration": 3600,
+			"renewable":      true,
+		}})
+	}))
+	loginCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(logins)
+	}
+	login := func(i int) string {
+		mu.Lock()
+		defer mu.Unlock()
+		return logins[i]
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "token")
+	// Tokens are swapped in atomically, the way the kubelet swaps ..data, so that the
+	// file is never seen empty.
+	rotate := func(jwt string) {
+		t.Helper()
+		tmp := filepath.Join(dir, ".token.tmp")
+		if err := os.WriteFile(tmp, []byte(jwt), 0o600); err != nil {
+			t.Fatalf("could not write token: %s", err)
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			t.Fatalf("could not rotate token: %s", err)
+		}
+	}
+	first := fakeJWT("first", time.Now().Add(time.Hour))
+	rotate(first)
+	t.Setenv("VAULT_ADDR", fake.URL)
+	t.Setenv("VAULT_AUTH_METHOD", "jwt")
+	t.Setenv("VAULT_ROLE", "app")
+	t.Setenv("VAULT_JWT_FILE", file)
+
+	client := NewVaultClient()
+	config := New(client, time.Minute, false)
+	defer config.Close()
+	if client.RawClient().Token() != "token-1" || login(0) != first {
+		t.Fatalf("expected a login with the service account token; got %q", client.RawClient().Token())
+	}
+
+	// A rotated token triggers a new login right away.
+	second := fakeJWT("second", time.Now().Add(time.Hour))
+	rotate(second)
+	waitFor(t, func() bool { return loginCount() == 2 })
+	if login(1) != second || client.RawClient().Token() != "token-2" {
+		t.Fatalf("expected a login with the rotated token; got %q", client.RawClient().Token())
+	}
+
+	// Once logins fail, read errors say why instead of only reporting a 403.
+	mu.Lock()
+	reject = true
+	mu.Unlock()
+	fake.handle("/v1/secret/test/app", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		writeJSON(w, map[string]any{"errors": []string{"permission denied"}})
+	}))
+	rotate(fakeJWT("third", time.Now().Add(time.Hour)))
+	l, _ := jwtLogins.Load(client)
+	jwt := l.(*jwtLogin)
+	waitFor(t, func() bool {
+		err := jwt.err()
+		return err != nil && strings.Contains(err.Error(), "rejected the service account token")
+	})
+
+	_, err := config.Get(context.Background(), "test/app#user")
+	if err == nil || !strings.Contains(err.Error(), "rejected the service account token") {
+		t.Fatalf("expected the login failure to be reported; got %v", err)
+	}
+
+	rotate(fakeJWT("expired", time.Now().Add(-time.Minute)))
+	waitFor(t, func() bool { return errors.Is(jwt.err(), ErrServiceAccountTokenExpired) })
+	if _, err := config.Get(context.Background(), "test/app#user"); !errors.Is(err, ErrServiceAccountTokenExpired) {
+		t.Fatalf("expected the expired token to be reported; got %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for condition")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,76 @@
+package confy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// errNoVaultClient is returned by the features that need Vault itself when the client
+// was created without one, to serve documents from another backend.
+var errNoVaultClient = errors.New("not available without a Vault client")
+
+// Backend loads the documents served by Get and Watch. By default, they are read from the
+// KV engine mounted at secret/ in Vault; WithBackend serves them from elsewhere, such as
+// a Bundle. Backends that also implement Lister are used by List.
+type Backend interface {
+	// Read returns the document at path, without the secret/ prefix. It must return an
+	// error wrapping ErrNotFound if there is no such document.
+	Read(ctx context.Context, path string) (*Document, error)
+}
+
+// BackendFunc adapts a function to the Backend interface.
+type BackendFunc func(ctx context.Context, path string) (*Document, error)
+
+func (f BackendFunc) Read(ctx context.Context, path string) (*Document, error) {
+	return f(ctx, path)
+}
+
+// Document is a document read by a Backend.
+type Document struct {
+	Data map[string]any
+	// Source names the backend, and Version the version of the document (or of the set
+	// of documents it came with). Both are reported in the provenance of its values.
+	Source  string
+	Version string
+	// Secret is the raw response, for documents read from Vault.
+	Secret *vaultapi.Secret
+}
+
+// WithBackend serves documents from b instead of the KV engine in Vault. The Vault client
+// given to New may then be nil, in which case the features that need Vault itself
+// (logical paths, identity tokens, event notifications) return errors or are disabled.
+func WithBackend(b Backend) Option {
+	return func(c *confyImpl) {
+		c.backend = b
+	}
+}
+
+// readKV reads a document from the KV engine mounted at secret/. It is the default backend.
+func (c *confyImpl) readKV(ctx context.Context, key string) (doc *Document, err error) {
+	if c.client == nil {
+		return nil, errNoVaultClient
+	}
+	defer func(start time.Time) { c.metrics.request("read", "secret/"+key, start, err) }(time.Now())
+
+	get := func(ctx context.Context, client *vaultapi.Client) (*vaultapi.KVSecret, error) {
+		return client.KVv1("secret").Get(ctx, key)
+	}
+	var resp *vaultapi.KVSecret
+	if c.hedger != nil {
+		resp, err = c.hedger.read(ctx, c.metrics, c.client.RawClient(), get)
+	} else {
+		resp, err = get(ctx, c.client.RawClient())
+	}
+	if errors.Is(err, vaultapi.ErrSecretNotFound) {
+		return nil, fmt.Errorf("secret '%s' was %w in Vault", key, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get secret from Vault: %w", c.loginError(err))
+	}
+
+	return &Document{Data: resp.Data, Source: SourceVault, Secret: resp.Raw}, nil
+}
@@ -0,0 +1,287 @@
+package confy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BundleFormat identifies the format of the bundles written by CreateBundle.
+const BundleFormat = "confy-bundle/v1"
+
+// ErrBundleSignature is returned by OpenBundle when a bundle is not signed by the expected key.
+var ErrBundleSignature = errors.New("bundle signature is not valid")
+
+// BundleOptions configures CreateBundle.
+type BundleOptions struct {
+	// Version is reported in the provenance of every value read from the bundle.
+	// It defaults to the creation time of the bundle, e.g. "20240102T150405Z".
+	Version string
+	// Signer signs the bundle. Ed25519, ECDSA and RSA keys are supported. It is required.
+	Signer crypto.Signer
+	// EncryptionKey, when set, encrypts the documents with AES-256-GCM. It must be 32 bytes long.
+	EncryptionKey []byte
+}
+
+// bundleEnvelope is the serialized form of a bundle. The documents are in Payload, as
+// gzipped JSON, encrypted if Encrypted is set. The signature covers every other field.
+type bundleEnvelope struct {
+	Format    string    `json:"format"`
+	Version   string    `json:"version"`
+	Prefix    string    `json:"prefix"`
+	CreatedAt time.Time `json:"created_at"`
+	Encrypted bool      `json:"encrypted"`
+	Payload   []byte    `json:"payload"`
+	Signature []byte    `json:"signature"`
+}
+
+// CreateBundle exports every document under prefix from src into a signed bundle, to be
+// served without Vault with OpenBundle and WithBackend. Bundles hold the documents as
+// they are read, so they contain secrets in the clear unless opts.EncryptionKey is set.
+func CreateBundle(ctx context.Context, src BundleSource, prefix string, opts BundleOptions) ([]byte, error) {
+	if opts.Signer == nil {
+		return nil, errors.New("a signer is required to create a bundle")
+	}
+
+	paths, err := src.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make(map[string]map[string]any, len(paths))
+	for _, path := range paths {
+		v, err := src.Get(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read '%s': %w", path, err)
+		}
+		data, _ := v.Data()
+		docs[path] = data
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(docs); err != nil {
+		return nil, fmt.Errorf("could not encode documents: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("could not compress documents: %w", err)
+	}
+
+	env := bundleEnvelope{
+		Format:    BundleFormat,
+		Version:   opts.Version,
+		Prefix:    strings.Trim(strings.TrimPrefix(prefix, "secret/"), "/"),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Payload:   buf.Bytes(),
+	}
+	if env.Version == "" {
+		env.Version = env.CreatedAt.Format("20060102T150405Z")
+	}
+	if opts.EncryptionKey != nil {
+		if env.Payload, err = sealBundle(opts.EncryptionKey, env.Payload); err != nil {
+			return nil, err
+		}
+		env.Encrypted = true
+	}
+
+	if env.Signature, err = signBundle(opts.Signer, env.digest()); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// Bundle is a set of documents exported by CreateBundle. It implements Backend and
+// Lister, so that it can be served by a client created with WithBackend:
+//
+//	b, err := confy.OpenBundle(data, publicKey, nil)
+//	...
+//	c := confy.New(nil, confy.DefaultCacheTTL, false, confy.WithBackend(b))
+//
+// Values read from it have a provenance with SourceBundle and the bundle version.
+type Bundle struct {
+	// Version is the version the bundle was created with.
+	Version string
+	// Prefix is the prefix the documents were exported from.
+	Prefix string
+	// CreatedAt is when the bundle was created.
+	CreatedAt time.Time
+
+	docs map[string]json.RawMessage
+}
+
+// OpenBundle verifies that data is a bundle signed with the private key matching pub,
+// and decrypts it with encryptionKey if it is encrypted.
+func OpenBundle(data []byte, pub crypto.PublicKey, encryptionKey []byte) (*Bundle, error) {
+	var env bundleEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("could not decode bundle: %w", err)
+	}
+	if env.Format != BundleFormat {
+		return nil, fmt.Errorf("unsupported bundle format '%s'", env.Format)
+	}
+	if err := verifyBundle(pub, env.digest(), env.Signature); err != nil {
+		return nil, err
+	}
+
+	payload := env.Payload
+	if env.Encrypted {
+		if encryptionKey == nil {
+			return nil, errors.New("bundle is encrypted, but no encryption key was given")
+		}
+		var err error
+		if payload, err = openBundle(encryptionKey, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress bundle: %w", err)
+	}
+	b := &Bundle{Version: env.Version, Prefix: env.Prefix, CreatedAt: env.CreatedAt}
+	if err := json.NewDecoder(zr).Decode(&b.docs); err != nil {
+		return nil, fmt.Errorf("could not decode bundle documents: %w", err)
+	}
+
+	return b, nil
+}
+
+// Read returns the document at path, without the secret/ prefix.
+func (b *Bundle) Read(_ context.Context, path string) (*Document, error) {
+	raw, ok := b.docs[strings.TrimPrefix(path, "secret/")]
+	if !ok {
+		return nil, fmt.Errorf("secret '%s' was %w in bundle %s", path, ErrNotFound, b.Version)
+	}
+
+	// Documents are decoded on every read, like they would be from Vault, so that
+	// callers cannot modify the bundle through them.
+	var data map[string]any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		return nil, fmt.Errorf("could not decode '%s' from bundle %s: %w", path, b.Version, err)
+	}
+
+	return &Document{Data: data, Source: SourceBundle, Version: b.Version}, nil
+}
+
+// List returns the paths of the documents under prefix in the bundle, sorted.
+func (b *Bundle) List(_ context.Context, prefix string) ([]string, error) {
+	prefix = strings.Trim(strings.TrimPrefix(prefix, "secret/"), "/")
+	paths := []string{}
+	for path := range b.docs {
+		if prefix == "" || strings.HasPrefix(path, prefix+"/") {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// digest returns the SHA-256 digest that the bundle signature is computed over.
+func (e *bundleEnvelope) digest() []byte {
+	h := sha256.New()
+	for _, field := range []string{e.Format, e.Version, e.Prefix, e.CreatedAt.Format(time.RFC3339Nano), strconv.FormatBool(e.Encrypted)} {
+		// Length prefixes keep the boundaries between fields unambiguous.
+		fmt.Fprintf(h, "%d:%s", len(field), field)
+	}
+	h.Write(e.Payload)
+
+	return h.Sum(nil)
+}
+
+func signBundle(signer crypto.Signer, digest []byte) ([]byte, error) {
+	var opts crypto.SignerOpts = crypto.SHA256
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		// Ed25519 signs the digest itself as the message.
+		opts = crypto.Hash(0)
+	}
+
+	sig, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not sign bundle: %w", err)
+	}
+
+	return sig, nil
+}
+
+func verifyBundle(pub crypto.PublicKey, digest, sig []byte) error {
+	var ok bool
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, digest, sig)
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(pub, digest, sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig) == nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	if !ok {
+		return ErrBundleSignature
+	}
+
+	return nil
+}
+
+func bundleCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("bundle encryption key must be 32 bytes long, not %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealBundle encrypts payload with AES-256-GCM. The nonce is prepended to the result.
+func sealBundle(key, payload []byte) ([]byte, error) {
+	aead, err := bundleCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(payload)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("could not generate nonce: %w", err)
+	}
+
+	return aead.Seal(nonce, nonce, payload, nil), nil
+}
+
+func openBundle(key, payload []byte) ([]byte, error) {
+	aead, err := bundleCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < aead.NonceSize() {
+		return nil, errors.New("encrypted bundle is truncated")
+	}
+
+	nonce, ciphertext := payload[:aead.NonceSize()], payload[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("could not decrypt bundle: wrong encryption key or corrupted bundle")
+	}
+
+	return plaintext, nil
+}
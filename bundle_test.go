@@ -0,0 +1,130 @@
+package confy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBundle(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"search/prod/app": {"user": "a", "pool": map[string]any{"size": 10}},
+		"search/prod/db":  {"password": "b"},
+		"other/app":       {"user": "c"},
+	})
+	src := new(fake.client(t), time.Minute, false)
+	defer src.Close()
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	data, err := CreateBundle(context.Background(), src.(*confyImpl), "secret/search/prod/", BundleOptions{
+		Version:       "v7",
+		Signer:        priv,
+		EncryptionKey: key,
+	})
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	if strings.Contains(string(data), "password") {
+		t.Fatalf("expected the documents to be encrypted: %s", data)
+	}
+
+	b, err := OpenBundle(data, pub, key)
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	if b.Version != "v7" || b.Prefix != "search/prod" {
+		t.Fatalf("unexpected bundle: %+v", b)
+	}
+	if paths, _ := b.List(context.Background(), "search/"); !reflect.DeepEqual(paths, []string{"search/prod/app", "search/prod/db"}) {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+
+	c := New(nil, time.Minute, false, WithBackend(b))
+	defer c.Close()
+	v, err := c.Get(context.Background(), "search/prod/app#pool.size")
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	if n, _ := v.Int(); n != 10 {
+		t.Fatalf("expected 10; got %v", v.Raw())
+	}
+	want := Provenance{Source: SourceBundle, Path: "search/prod/app#pool.size", Version: "v7"}
+	if p := v.Provenance(); p.Source != want.Source || p.Path != want.Path || p.Version != want.Version || p.LoadedAt.IsZero() {
+		t.Fatalf("unexpected provenance: %+v", p)
+	}
+
+	if _, err := c.Get(context.Background(), "other/app#user"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a not found error; got %v", err)
+	}
+	if _, err := c.(LogicalClient).Logical(context.Background(), "sys/health", nil); !errors.Is(err, errNoVaultClient) {
+		t.Fatalf("expected logical reads to fail without Vault; got %v", err)
+	}
+
+	if _, err := OpenBundle(data, pub, nil); err == nil {
+		t.Fatal("expected an error without the encryption key")
+	}
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := OpenBundle(data, otherPub, key); !errors.Is(err, ErrBundleSignature) {
+		t.Fatalf("expected a signature error; got %v", err)
+	}
+	tampered := strings.Replace(string(data), `"version": "v7"`, `"version": "v8"`, 1)
+	if _, err := OpenBundle([]byte(tampered), pub, key); !errors.Is(err, ErrBundleSignature) {
+		t.Fatalf("expected a signature error for a tampered bundle; got %v", err)
+	}
+}
+
+func TestBundleSigners(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fake := newFakeVault(t, map[string]map[string]any{"search/app": {"user": "a"}})
+	src := new(fake.client(t), time.Minute, false)
+	defer src.Close()
+
+	for name, signer := range map[string]crypto.Signer{"rsa": rsaKey, "ecdsa": ecKey} {
+		t.Run(name, func(t *testing.T) {
+			data, err := CreateBundle(context.Background(), src.(*confyImpl), "search/", BundleOptions{Signer: signer})
+			if err != nil {
+				t.Fatalf("did not expect an error: %s", err)
+			}
+			b, err := OpenBundle(data, signer.Public(), nil)
+			if err != nil {
+				t.Fatalf("did not expect an error: %s", err)
+			}
+			doc, err := b.Read(context.Background(), "search/app")
+			if err != nil || doc.Data["user"] != "a" || doc.Version != b.Version || b.Version == "" {
+				t.Fatalf("unexpected document: %+v, %v", doc, err)
+			}
+		})
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{"app": {"user": "a"}})
+	t.Setenv("APP_PASSWORD", "env")
+	c := new(fake.client(t), time.Minute, true)
+	defer c.Close()
+
+	v, _ := c.Get(context.Background(), "app#user")
+	if p := v.Provenance(); p.Source != SourceVault || p.Path != "app#user" || p.LoadedAt.IsZero() {
+		t.Fatalf("unexpected provenance: %+v", p)
+	}
+	v, _ = c.Get(context.Background(), "app#password")
+	if p := v.Provenance(); p.Source != SourceEnvironment || p.Path != "app#password" {
+		t.Fatalf("unexpected provenance: %+v", p)
+	}
+	v, _ = c.GetOrDefault(context.Background(), "app#missing", "x")
+	if p := v.Provenance(); p.Source != SourceDefault {
+		t.Fatalf("unexpected provenance: %+v", p)
+	}
+}
@@ -0,0 +1,183 @@
+package confy
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCallbackWorkers is how many watch callbacks may run at the same time,
+	// unless WithCallbackWorkers says otherwise.
+	DefaultCallbackWorkers = 4
+	// DefaultCallbackTimeout is how long a watch callback may run before it is reported,
+	// unless WithCallbackTimeout says otherwise.
+	DefaultCallbackTimeout = 30 * time.Second
+)
+
+var (
+	// ErrCallbackPanicked is reported (wrapped in a *WatchError) when a watch callback panics.
+	ErrCallbackPanicked = errors.New("watch callback panicked")
+	// ErrCallbackTimedOut is reported (wrapped in a *WatchError) when a watch callback runs
+	// for longer than the callback timeout.
+	ErrCallbackTimedOut = errors.New("watch callback timed out")
+)
+
+// WatchError is reported to the error handler when a watch callback fails.
+type WatchError struct {
+	Path string
+	Err  error
+	// Panic and Stack are set when the callback panicked.
+	Panic any
+	Stack []byte
+}
+
+func (e *WatchError) Error() string {
+	if e.Panic != nil {
+		return fmt.Sprintf("%s on path '%s': %v", e.Err, e.Path, e.Panic)
+	}
+	return fmt.Sprintf("%s on path '%s'", e.Err, e.Path)
+}
+
+func (e *WatchError) Unwrap() error {
+	return e.Err
+}
+
+// WithErrorHandler sets a function that is called with errors that happen in the
+// background, such as watch callbacks that panic or time out (see WatchError). Errors
+// are logged regardless.
+func WithErrorHandler(handler func(error)) Option {
+	return func(c *confyImpl) {
+		c.errorHandler = handler
+	}
+}
+
+// WithCallbackWorkers sets how many watch callbacks may run at the same time, across
+// every watch of the client. It is DefaultCallbackWorkers by default. Callbacks that timed
+// out (see WithCallbackTimeout) no longer count, so they may run beyond this limit.
+func WithCallbackWorkers(n int) Option {
+	return func(c *confyImpl) {
+		if n > 0 {
+			c.callbacks.workers = n
+		}
+	}
+}
+
+// WithCallbackTimeout sets how long a watch callback may run before it is reported as
+// timed out. Go cannot stop a running function, so the callback keeps running, but it
+// stops holding one of the workers, and the watch moves on to the next change: a later
+// callback of the same watch may then run, and finish, before the timed-out one. Whatever
+// the timed-out callback does once it returns, including panicking, is not reported.
+// 0 disables the timeout, and a stuck callback then ends the deliveries of its watch.
+func WithCallbackTimeout(timeout time.Duration) Option {
+	return func(c *confyImpl) {
+		c.callbacks.timeout = timeout
+	}
+}
+
+// reportError logs err and hands it to the error handler, if there is one.
+func (c *confyImpl) reportError(err error, fields map[string]any) {
+	if fields == nil {
+		fields = map[string]any{}
+	}
+	fields["err"] = err
+	c.logger.Error("confy background error", fields)
+	if c.errorHandler != nil {
+		c.errorHandler(err)
+	}
+}
+
+// callbackPool bounds how many watch callbacks run at the same time.
+type callbackPool struct {
+	workers int
+	timeout time.Duration
+	slots   chan struct{}
+}
+
+// callbackQueue delivers the changes detected by one watch to its callback. Callbacks
+// of a watch never run concurrently, and run in the order changes were detected, unless
+// one times out. If several changes are detected while a callback is running, only the
+// latest one is delivered once it returns or times out, since it supersedes the others.
+type callbackQueue struct {
+	c        *confyImpl
+	path     string
+	callback func(v Value)
+
+	mu      sync.Mutex
+	running bool
+	pending Value
+}
+
+func (c *confyImpl) newCallbackQueue(path string, callback func(v Value)) *callbackQueue {
+	return &callbackQueue{c: c, path: path, callback: callback}
+}
+
+// submit schedules the callback for v, without waiting for it to run.
+func (q *callbackQueue) submit(v Value) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.running {
+		q.pending = v
+		return
+	}
+	q.running = true
+	go q.drain(v)
+}
+
+func (q *callbackQueue) drain(v Value) {
+	for {
+		q.c.runCallback(q.path, v, q.callback)
+
+		q.mu.Lock()
+		if q.pending == nil {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		v, q.pending = q.pending, nil
+		q.mu.Unlock()
+	}
+}
+
+// runCallback runs callback, through the watch interceptors, on one of the workers.
+// It returns once the callback returns or times out. A timed-out callback is left
+// running on its own, and its outcome is dropped.
+func (c *confyImpl) runCallback(path string, v Value, callback func(v Value)) {
+	select {
+	case c.callbacks.slots <- struct{}{}:
+	case <-c.done:
+		return
+	}
+	defer func() { <-c.callbacks.slots }()
+
+	// finished is buffered, so that a callback finishing after its timeout does not block.
+	finished := make(chan *WatchError, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				finished <- &WatchError{Path: path, Err: ErrCallbackPanicked, Panic: r, Stack: debug.Stack()}
+			}
+		}()
+		c.dispatch(path, v, callback)
+		finished <- nil
+	}()
+
+	var timeout <-chan time.Time
+	if c.callbacks.timeout > 0 {
+		timer := time.NewTimer(c.callbacks.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case err := <-finished:
+		if err != nil {
+			c.reportError(err, map[string]any{"path": path, "stack": string(err.Stack)})
+		}
+		return
+	case <-timeout:
+		c.reportError(&WatchError{Path: path, Err: ErrCallbackTimedOut}, map[string]any{"path": path, "timeout": c.callbacks.timeout.String()})
+	}
+}
@@ -0,0 +1,109 @@
+package confy
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCallbackPanics(t *testing.T) {
+	fake := newFakeVault(t, nil)
+	errs := make(chan error, 1)
+	c := new(fake.client(t), time.Minute, false, WithErrorHandler(func(err error) { errs <- err })).(*confyImpl)
+	defer c.Close()
+
+	calls := make(chan string, 2)
+	q := c.newCallbackQueue("test/app#user", func(v Value) {
+		calls <- v.String()
+		if v.String() == "boom" {
+			panic("callback failed")
+		}
+	})
+
+	q.submit(&value{val: "boom", set: true})
+	var watchErr *WatchError
+	select {
+	case err := <-errs:
+		if !errors.As(err, &watchErr) || !errors.Is(err, ErrCallbackPanicked) || watchErr.Panic != "callback failed" || watchErr.Path != "test/app#user" {
+			t.Fatalf("expected the panic to be reported; got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the panic to be reported")
+	}
+
+	// The watch carries on after a panic.
+	q.submit(&value{val: "fine", set: true})
+	waitFor(t, func() bool { return len(calls) == 2 })
+}
+
+func TestCallbackTimeoutAndOrdering(t *testing.T) {
+	fake := newFakeVault(t, nil)
+	errs := make(chan error, 1)
+	c := new(fake.client(t), time.Minute, false,
+		WithCallbackWorkers(1),
+		WithCallbackTimeout(50*time.Millisecond),
+		WithErrorHandler(func(err error) { errs <- err }),
+	).(*confyImpl)
+	defer c.Close()
+
+	var mu sync.Mutex
+	seen := []string{}
+	unblock := make(chan struct{})
+	slow := c.newCallbackQueue("slow", func(v Value) {
+		if v.String() == "1" {
+			<-unblock
+		}
+		mu.Lock()
+		seen = append(seen, v.String())
+		mu.Unlock()
+	})
+	other := make(chan struct{})
+	fast := c.newCallbackQueue("fast", func(v Value) { close(other) })
+
+	slow.submit(&value{val: "1", set: true})
+	slow.submit(&value{val: "2", set: true})
+	slow.submit(&value{val: "3", set: true})
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrCallbackTimedOut) {
+			t.Fatalf("expected a timeout; got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the timeout to be reported")
+	}
+
+	// The stuck callback no longer holds the only worker, and its watch moves on to the
+	// latest change.
+	fast.submit(&value{val: "x", set: true})
+	select {
+	case <-other:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected other watches to run while a callback is stuck")
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seen) == 1
+	})
+	if seen[0] != "3" {
+		t.Fatalf("expected the changes behind the stuck callback to be coalesced to the latest; got %v", seen)
+	}
+
+	// Changes after the timeout are delivered in order.
+	slow.submit(&value{val: "4", set: true})
+	slow.submit(&value{val: "5", set: true})
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seen) >= 2 && seen[len(seen)-1] == "5"
+	})
+
+	close(unblock)
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen[len(seen)-1] == "1"
+	})
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/renier/confy"
+)
+
+func runBundle(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "create":
+			return runBundleCreate(args[1:])
+		case "verify":
+			return runBundleVerify(args[1:])
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "usage: confy bundle create [flags] prefix/")
+	fmt.Fprintln(os.Stderr, "       confy bundle verify [flags] bundle.json")
+	return 2
+}
+
+func runBundleCreate(args []string) int {
+	fs := flag.NewFlagSet("bundle create", flag.ExitOnError)
+	sign := fs.String("sign", "", "PEM file with the private key to sign the bundle with (required)")
+	encryptKey := fs.String("encrypt-key", "", "file with a 32 byte key, raw or base64, to encrypt the bundle with")
+	version := fs.String("version", "", "version of the bundle (defaults to its creation time)")
+	out := fs.String("o", "", "file to write the bundle to (defaults to standard output)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: confy bundle create -sign key.pem [flags] prefix/")
+		fmt.Fprintln(fs.Output(), "\nExports every document under prefix into a signed bundle, to be served without Vault")
+		fmt.Fprintln(fs.Output(), "with confy.OpenBundle. Bundles contain secrets in the clear unless -encrypt-key is set.")
+		fs.PrintDefaults()
+	}
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 || *sign == "" {
+		fs.Usage()
+		return 2
+	}
+
+	signer, err := readSigner(*sign)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	key, err := readEncryptionKey(*encryptKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	c := newClient()
+	defer c.Close()
+	bundle, err := confy.CreateBundle(context.Background(), c.(confy.BundleSource), positional[0], confy.BundleOptions{Version: *version, Signer: signer, EncryptionKey: key})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *out == "" {
+		_, _ = os.Stdout.Write(append(bundle, '\n'))
+		return 0
+	}
+	if err := os.WriteFile(*out, bundle, 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runBundleVerify(args []string) int {
+	fs := flag.NewFlagSet("bundle verify", flag.ExitOnError)
+	pub := fs.String("key", "", "file with the public key or certificate the bundle should be signed with (required)")
+	encryptKey := fs.String("encrypt-key", "", "file with the key the bundle was encrypted with")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: confy bundle verify -key pub.pem [flags] bundle.json")
+		fmt.Fprintln(fs.Output(), "\nChecks the signature of a bundle and lists the documents in it.")
+		fs.PrintDefaults()
+	}
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 || *pub == "" {
+		fs.Usage()
+		return 2
+	}
+
+	key, err := readPublicKey(*pub)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	encKey, err := readEncryptionKey(*encryptKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	data, err := os.ReadFile(positional[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	b, err := confy.OpenBundle(data, key, encKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	paths, _ := b.List(context.Background(), "")
+	fmt.Printf("bundle %s of %s/, created %s: signature OK\n", b.Version, b.Prefix, b.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	for _, path := range paths {
+		fmt.Println("  " + path)
+	}
+	return 0
+}
+
+// parseInterspersed parses args with fs, allowing flags after the positional arguments
+// (as in "confy bundle create prefix/ --sign key.pem"), and returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		_ = fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// readSigner reads a private key from a PEM file, in any of the formats of confy.PrivateKey.
+func readSigner(file string) (crypto.Signer, error) {
+	v, err := readKeyFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := confy.PrivateKey(v)
+	if err != nil {
+		return nil, fmt.Errorf("could not read private key in %s: %w", file, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key in %s cannot sign", file)
+	}
+	return signer, nil
+}
+
+// readPublicKey reads a public key, or the public key of a certificate, from a file, in any
+// of the formats of confy.PublicKey.
+func readPublicKey(file string) (crypto.PublicKey, error) {
+	v, err := readKeyFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := confy.PublicKey(v)
+	if err != nil {
+		return nil, fmt.Errorf("could not read public key in %s: %w", file, err)
+	}
+	return key, nil
+}
+
+func readKeyFile(file string) (confy.Value, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return confy.StringValue(string(data)), nil
+}
+
+// readEncryptionKey reads a 32 byte key, stored raw or base64 encoded. It returns nil if
+// file is empty.
+func readEncryptionKey(file string) ([]byte, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 32 {
+		return data, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes, raw or base64 encoded")
+	}
+	return key, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %s", err)
+	}
+	der, _ := x509.MarshalECPrivateKey(key)
+	pubDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	dir := t.TempDir()
+	write := func(name, typ string, der []byte) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatalf("could not write %s: %s", name, err)
+		}
+		return file
+	}
+
+	signer, err := readSigner(write("key.pem", "EC PRIVATE KEY", der))
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	pub, err := readPublicKey(write("pub.pem", "PUBLIC KEY", pubDER))
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	if !key.PublicKey.Equal(signer.Public()) || !key.PublicKey.Equal(pub) {
+		t.Fatalf("expected the keys of the files")
+	}
+
+	if _, err := readSigner(filepath.Join(dir, "pub.pem")); err == nil {
+		t.Fatalf("expected an error reading a public key as a private key")
+	}
+}
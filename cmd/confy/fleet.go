@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/renier/confy"
+)
+
+func runFleetCheck(args []string) int {
+	fs := flag.NewFlagSet("fleet-check", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 5*time.Second, "timeout for each request")
+	file := fs.String("f", "", "file with one admin endpoint URL per line")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: confy fleet-check [flags] URL...")
+		fmt.Fprintln(fs.Output(), "\nEach URL is the documents endpoint of a replica's confy admin handler,")
+		fmt.Fprintln(fs.Output(), "e.g. http://10.0.0.12:8080/confy/documents.")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	endpoints := fs.Args()
+	if *file != "" {
+		more, err := readLines(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not read endpoints: %s\n", err)
+			return 2
+		}
+		endpoints = append(endpoints, more...)
+	}
+	if len(endpoints) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	reports, failed := scrape(endpoints, *timeout)
+	divergences := checkFleet(reports, time.Now())
+	printFleetCheck(os.Stdout, len(reports), divergences)
+
+	switch {
+	case failed:
+		return 2
+	case len(divergences) > 0:
+		return 1
+	}
+	return 0
+}
+
+// scrape fetches the documents reported by every endpoint. Endpoints that cannot be
+// reached are reported on stderr and left out.
+func scrape(endpoints []string, timeout time.Duration) (map[string][]confy.DocumentInfo, bool) {
+	client := &http.Client{Timeout: timeout}
+	reports := map[string][]confy.DocumentInfo{}
+	failed := false
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, endpoint := range endpoints {
+		wg.Add(1)
+		go func(endpoint string) {
+			defer wg.Done()
+			docs, err := fetchDocuments(client, endpoint)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", endpoint, err)
+				failed = true
+				return
+			}
+			reports[endpoint] = docs
+		}(endpoint)
+	}
+	wg.Wait()
+
+	return reports, failed
+}
+
+func fetchDocuments(client *http.Client, endpoint string) ([]confy.DocumentInfo, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var docs []confy.DocumentInfo
+	if err := json.NewDecoder(resp.Body).Decode(&docs); err != nil {
+		return nil, fmt.Errorf("could not decode documents: %w", err)
+	}
+	for _, doc := range docs {
+		if doc.Hash == "" {
+			return nil, fmt.Errorf("document %s has no hash; replicas must share a key set with confy.WithDocumentHashKey", doc.Path)
+		}
+	}
+
+	return docs, nil
+}
+
+// variant is one of the contents seen for a document across the fleet.
+type variant struct {
+	Hash    string
+	Version int64
+	Pods    []string
+	// Since is when the first pod saw this content.
+	Since time.Time
+	// Stale is how long this content has been superseded by the latest one.
+	// It is zero for the latest content.
+	Stale time.Duration
+}
+
+type divergence struct {
+	Path     string
+	Variants []variant
+}
+
+// checkFleet returns the documents whose content differs between pods. For each of them,
+// the content seen most recently by any pod is considered the latest one, and the
+// others are stale since it first appeared.
+func checkFleet(reports map[string][]confy.DocumentInfo, now time.Time) []divergence {
+	byPath := map[string]map[string]*variant{}
+	for pod, docs := range reports {
+		for _, doc := range docs {
+			if byPath[doc.Path] == nil {
+				byPath[doc.Path] = map[string]*variant{}
+			}
+			v, ok := byPath[doc.Path][doc.Hash]
+			if !ok {
+				v = &variant{Hash: doc.Hash, Version: doc.Version, Since: doc.ChangedAt}
+				byPath[doc.Path][doc.Hash] = v
+			}
+			v.Pods = append(v.Pods, pod)
+			if doc.ChangedAt.Before(v.Since) {
+				v.Since = doc.ChangedAt
+			}
+		}
+	}
+
+	divergences := []divergence{}
+	for path, variants := range byPath {
+		if len(variants) < 2 {
+			continue
+		}
+
+		d := divergence{Path: path}
+		for _, v := range variants {
+			sort.Strings(v.Pods)
+			d.Variants = append(d.Variants, *v)
+		}
+		sort.Slice(d.Variants, func(i, j int) bool { return d.Variants[i].Since.After(d.Variants[j].Since) })
+		latest := d.Variants[0].Since
+		for i := range d.Variants[1:] {
+			d.Variants[i+1].Stale = now.Sub(latest)
+		}
+		divergences = append(divergences, d)
+	}
+	sort.Slice(divergences, func(i, j int) bool { return divergences[i].Path < divergences[j].Path })
+
+	return divergences
+}
+
+func printFleetCheck(w io.Writer, pods int, divergences []divergence) {
+	if len(divergences) == 0 {
+		fmt.Fprintf(w, "all %d pods agree on every document\n", pods)
+		return
+	}
+
+	fmt.Fprintf(w, "%d documents diverge across %d pods\n", len(divergences), pods)
+	for _, d := range divergences {
+		fmt.Fprintf(w, "\n%s\n", d.Path)
+		for i, v := range d.Variants {
+			status := "latest"
+			if i > 0 {
+				status = fmt.Sprintf("stale for %s", v.Stale.Round(time.Second))
+			}
+			version := ""
+			if v.Version > 0 {
+				version = fmt.Sprintf(" v%d", v.Version)
+			}
+			fmt.Fprintf(w, "  %.12s%s (%s): %s\n", v.Hash, version, status, strings.Join(v.Pods, ", "))
+		}
+	}
+}
+
+func readLines(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
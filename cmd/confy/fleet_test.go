@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/renier/confy"
+)
+
+func TestCheckFleet(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-time.Hour)
+	rollout := now.Add(-10 * time.Minute)
+	reports := map[string][]confy.DocumentInfo{
+		"pod-a": {{Path: "app", Hash: "new", ChangedAt: rollout}, {Path: "db", Hash: "same", ChangedAt: old}},
+		"pod-b": {{Path: "app", Hash: "new", ChangedAt: rollout.Add(time.Minute)}, {Path: "db", Hash: "same", ChangedAt: old}},
+		"pod-c": {{Path: "app", Hash: "old", ChangedAt: old}},
+	}
+
+	divergences := checkFleet(reports, now)
+	if len(divergences) != 1 || divergences[0].Path != "app" {
+		t.Fatalf("expected only app to diverge; got %+v", divergences)
+	}
+
+	variants := divergences[0].Variants
+	if variants[0].Hash != "new" || len(variants[0].Pods) != 2 || variants[0].Stale != 0 {
+		t.Fatalf("expected the new content first; got %+v", variants[0])
+	}
+	if variants[1].Hash != "old" || variants[1].Stale != 10*time.Minute {
+		t.Fatalf("expected the old content to be stale since the rollout; got %+v", variants[1])
+	}
+}
+
+func TestFetchDocuments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]confy.DocumentInfo{{Path: "app", Hash: "abc"}})
+	}))
+	defer server.Close()
+
+	reports, failed := scrape([]string{server.URL, "http://127.0.0.1:1/documents"}, time.Second)
+	if !failed {
+		t.Fatalf("expected the unreachable endpoint to be reported")
+	}
+	if docs := reports[server.URL]; len(docs) != 1 || docs[0].Hash != "abc" {
+		t.Fatalf("unexpected documents: %+v", docs)
+	}
+}
+
+func TestFetchDocumentsWithoutHash(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]confy.DocumentInfo{{Path: "app"}})
+	}))
+	defer server.Close()
+
+	if _, err := fetchDocuments(server.Client(), server.URL); err == nil {
+		t.Fatalf("expected an error for documents without a hash")
+	}
+}
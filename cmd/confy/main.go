@@ -0,0 +1,66 @@
+// Command confy provides operational tooling for configuration stored in Vault
+// and read through the confy package.
+//
+// Usage:
+//
+//	confy <command> [flags] [arguments]
+//
+// Commands:
+//
+//	fleet-check  compare the documents loaded by several replicas
+//	schema       infer JSON schemas from the documents under a prefix
+//	scan         report placeholder, weak, reused and old secrets under a prefix
+//	bundle       create and verify signed bundles of documents for use without Vault
+//
+// Commands that read from Vault use the same environment variables as confy.NewVaultClient.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/renier/confy"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands = []command{
+	{name: "fleet-check", usage: "compare the documents loaded by several replicas", run: runFleetCheck},
+	{name: "schema", usage: "infer JSON schemas from the documents under a prefix", run: runSchema},
+	{name: "scan", usage: "report placeholder, weak, reused and old secrets under a prefix", run: runScan},
+	{name: "bundle", usage: "create and verify signed bundles of documents for use without Vault", run: runBundle},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "confy: unknown command '%s'\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: confy <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+// newClient returns a client for the Vault configured in the environment.
+func newClient() confy.Confy {
+	return confy.New(confy.NewVaultClient(), confy.MinimumCacheTTL, false)
+}
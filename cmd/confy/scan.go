@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/renier/confy"
+)
+
+func runScan(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	kv2Mount := fs.String("kv2-mount", "", "scan prefix on this KV v2 mount instead of the secret/ KV v1 mount")
+	maxAge := fs.Duration("max-age", 0, "with -kv2-mount, report documents created longer ago than this, e.g. 2160h (disabled by default)")
+	minEntropy := fs.Float64("min-entropy", confy.DefaultMinEntropyBits, "minimum estimated entropy of secrets, in bits")
+	asJSON := fs.Bool("json", false, "print the findings as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: confy scan [flags] prefix/")
+		fmt.Fprintln(fs.Output(), "\nReports placeholder values, weak and reused secrets, and documents due for rotation")
+		fmt.Fprintln(fs.Output(), "under prefix. Values are redacted. Exits with 1 if anything was found.")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	c := newClient()
+	defer c.Close()
+	findings, err := c.(confy.Scanner).Scan(context.Background(), fs.Arg(0), confy.ScanPolicy{
+		MinEntropyBits: *minEntropy,
+		KVv2Mount:      *kv2Mount,
+		MaxAge:         *maxAge,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(findings)
+	} else {
+		printFindings(os.Stdout, findings)
+	}
+
+	if len(findings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printFindings(w io.Writer, findings []confy.Finding) {
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "no findings")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tPATH\tVALUE\tDETAIL")
+	for _, f := range findings {
+		path := f.Path
+		if f.Field != "" {
+			path += "#" + f.Field
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Kind, path, f.Value, f.Detail)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/renier/confy"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+func runSchema(args []string) int {
+	if len(args) == 0 || args[0] != "infer" {
+		fmt.Fprintln(os.Stderr, "usage: confy schema infer [flags] prefix/")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("schema infer", flag.ExitOnError)
+	out := fs.String("out", "schemas", "directory the schemas are written to")
+	envSegment := fs.Int("env-segment", 0, "index of the path segment below the prefix that names the environment; "+
+		"documents that only differ in it share a schema. -1 infers one schema per document")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: confy schema infer [flags] prefix/")
+		fmt.Fprintln(fs.Output(), "\nReads every document under prefix and writes a JSON Schema for each of them, or")
+		fmt.Fprintln(fs.Output(), "for each path pattern across environments, flagging fields whose type differs.")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	prefix := strings.Trim(strings.TrimPrefix(fs.Arg(0), "secret/"), "/")
+
+	c := newClient()
+	defer c.Close()
+	docs, err := readDocuments(context.Background(), c, prefix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	groups := inferSchemas(prefix, docs, *envSegment)
+	if err := writeSchemas(*out, groups); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	printSchemaReport(os.Stdout, *out, groups)
+
+	return 0
+}
+
+// readDocuments reads every document under prefix, by path.
+func readDocuments(ctx context.Context, c confy.Confy, prefix string) (map[string]map[string]any, error) {
+	paths, err := c.(confy.Lister).List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make(map[string]map[string]any, len(paths))
+	for _, path := range paths {
+		v, err := c.Get(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		data, _ := v.Data()
+		docs[path] = data
+	}
+
+	return docs, nil
+}
+
+// schemaGroup is a set of documents described by the same schema: a single document, or
+// the same document across environments.
+type schemaGroup struct {
+	Pattern      string
+	Environments []string
+	Root         *typeNode
+	Conflicts    []typeConflict
+}
+
+// typeConflict is a field that was seen with different types.
+type typeConflict struct {
+	Field string
+	// Types maps every type seen to the environments it was seen in.
+	Types map[string][]string
+}
+
+// inferSchemas groups docs by path pattern, replacing the envSegment-th segment below
+// prefix with a wildcard, and infers a schema for each group. A negative envSegment
+// puts every document in its own group.
+func inferSchemas(prefix string, docs map[string]map[string]any, envSegment int) []*schemaGroup {
+	groups := map[string]*schemaGroup{}
+	for path, data := range docs {
+		pattern, env := path, path
+		segments := strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, prefix), "/"), "/")
+		if envSegment >= 0 && envSegment < len(segments)-1 {
+			env = segments[envSegment]
+			segments[envSegment] = "*"
+			pattern = strings.TrimPrefix(prefix+"/"+strings.Join(segments, "/"), "/")
+		}
+
+		g, ok := groups[pattern]
+		if !ok {
+			g = &schemaGroup{Pattern: pattern, Root: newTypeNode()}
+			groups[pattern] = g
+		}
+		g.Environments = append(g.Environments, env)
+		g.Root.observe(env, data)
+	}
+
+	list := make([]*schemaGroup, 0, len(groups))
+	for _, g := range groups {
+		sort.Strings(g.Environments)
+		g.Root.conflicts("", &g.Conflicts)
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Pattern < list[j].Pattern })
+
+	return list
+}
+
+// typeNode accumulates the values seen at one place of a group of documents.
+type typeNode struct {
+	// types maps every JSON Schema type seen to the environments it was seen in.
+	types map[string][]string
+	// objects is how many times an object was seen; properties present every time are required.
+	objects    int
+	seen       int
+	properties map[string]*typeNode
+	items      *typeNode
+}
+
+func newTypeNode() *typeNode {
+	return &typeNode{types: map[string][]string{}, properties: map[string]*typeNode{}}
+}
+
+func (n *typeNode) observe(env string, v any) {
+	n.seen++
+	t := jsonType(v)
+	if envs := n.types[t]; len(envs) == 0 || envs[len(envs)-1] != env {
+		n.types[t] = append(envs, env)
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		n.objects++
+		for k, val := range v {
+			if n.properties[k] == nil {
+				n.properties[k] = newTypeNode()
+			}
+			n.properties[k].observe(env, val)
+		}
+	case []any:
+		if n.items == nil {
+			n.items = newTypeNode()
+		}
+		for _, val := range v {
+			n.items.observe(env, val)
+		}
+	}
+}
+
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+
+	return "string"
+}
+
+// schemaTypes returns the types seen, with integers folded into numbers when both were seen.
+func (n *typeNode) schemaTypes() []string {
+	types := []string{}
+	for t := range n.types {
+		if t == "integer" && len(n.types["number"]) > 0 {
+			continue
+		}
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// conflicts collects the fields under n seen with more than one type. Nulls, and integers
+// next to other numbers, are not considered conflicts.
+func (n *typeNode) conflicts(field string, found *[]typeConflict) {
+	types := map[string][]string{}
+	for _, t := range n.schemaTypes() {
+		if t != "null" {
+			types[t] = n.types[t]
+		}
+	}
+	if len(types) > 1 {
+		*found = append(*found, typeConflict{Field: field, Types: types})
+	}
+
+	names := make([]string, 0, len(n.properties))
+	for name := range n.properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := name
+		if field != "" {
+			child = field + "." + name
+		}
+		n.properties[name].conflicts(child, found)
+	}
+	if n.items != nil {
+		n.items.conflicts(field+"[]", found)
+	}
+}
+
+// schema returns the JSON Schema of n. Values are never included, since documents hold secrets.
+func (n *typeNode) schema() map[string]any {
+	s := map[string]any{}
+	switch types := n.schemaTypes(); len(types) {
+	case 0:
+	case 1:
+		s["type"] = types[0]
+	default:
+		s["type"] = types
+	}
+
+	if len(n.properties) > 0 {
+		props := map[string]any{}
+		required := []string{}
+		for name, child := range n.properties {
+			props[name] = child.schema()
+			if child.seen >= n.objects {
+				required = append(required, name)
+			}
+		}
+		sort.Strings(required)
+		s["properties"] = props
+		if len(required) > 0 {
+			s["required"] = required
+		}
+	}
+	if n.items != nil {
+		s["items"] = n.items.schema()
+	}
+
+	return s
+}
+
+// schemaFileName returns the name of the file the schema of pattern is written to.
+func schemaFileName(pattern string) string {
+	return strings.NewReplacer("/", ".", "*", "_").Replace(pattern) + ".schema.json"
+}
+
+func writeSchemas(dir string, groups []*schemaGroup) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		s := g.Root.schema()
+		s["$schema"] = jsonSchemaDraft
+		s["title"] = g.Pattern
+		content, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, schemaFileName(g.Pattern)), append(content, '\n'), 0o644); err != nil { //nolint:gosec
+			return err
+		}
+	}
+
+	return nil
+}
+
+func printSchemaReport(w io.Writer, dir string, groups []*schemaGroup) {
+	conflicts := 0
+	for _, g := range groups {
+		fmt.Fprintf(w, "%s: %d documents (%s)\n", filepath.Join(dir, schemaFileName(g.Pattern)), len(g.Environments), strings.Join(g.Environments, ", "))
+		conflicts += len(g.Conflicts)
+	}
+	if conflicts == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n%d fields have different types across documents:\n", conflicts)
+	for _, g := range groups {
+		for _, c := range g.Conflicts {
+			types := make([]string, 0, len(c.Types))
+			for t, envs := range c.Types {
+				types = append(types, fmt.Sprintf("%s in %s", t, strings.Join(envs, ", ")))
+			}
+			sort.Strings(types)
+			fmt.Fprintf(w, "  %s#%s: %s\n", g.Pattern, c.Field, strings.Join(types, "; "))
+		}
+	}
+}
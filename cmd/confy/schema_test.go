@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInferSchemas(t *testing.T) {
+	docs := map[string]map[string]any{
+		"search/prod/app": {"user": "u", "ss": json.Number("3"), "pool": map[string]any{"size": json.Number("10")}},
+		"search/dev/app":  {"user": "u", "ss": "3", "pool": map[string]any{"size": json.Number("2.5")}, "debug": true},
+		"search/dev/db":   {"hosts": []any{"a", "b"}},
+	}
+
+	groups := inferSchemas("search", docs, 0)
+	if len(groups) != 2 || groups[0].Pattern != "search/*/app" || groups[1].Pattern != "search/*/db" {
+		t.Fatalf("unexpected groups: %+v", groups)
+	}
+
+	app := groups[0]
+	if !reflect.DeepEqual(app.Environments, []string{"dev", "prod"}) {
+		t.Fatalf("unexpected environments: %v", app.Environments)
+	}
+	if len(app.Conflicts) != 1 || app.Conflicts[0].Field != "ss" ||
+		!reflect.DeepEqual(app.Conflicts[0].Types, map[string][]string{"integer": {"prod"}, "string": {"dev"}}) {
+		t.Fatalf("expected only ss to conflict; got %+v", app.Conflicts)
+	}
+
+	s := app.Root.schema()
+	if !reflect.DeepEqual(s["required"], []string{"pool", "ss", "user"}) {
+		t.Fatalf("expected fields present everywhere to be required; got %v", s["required"])
+	}
+	props := s["properties"].(map[string]any)
+	if size := props["pool"].(map[string]any)["properties"].(map[string]any)["size"]; !reflect.DeepEqual(size, map[string]any{"type": "number"}) {
+		t.Fatalf("expected integers and numbers to fold into numbers; got %v", size)
+	}
+
+	perDocument := inferSchemas("search", docs, -1)
+	if len(perDocument) != 3 || len(perDocument[0].Conflicts) != 0 {
+		t.Fatalf("expected one schema per document; got %+v", perDocument)
+	}
+}
+
+func TestWriteSchemas(t *testing.T) {
+	dir := t.TempDir()
+	groups := inferSchemas("search", map[string]map[string]any{"search/dev/db": {"hosts": []any{"a"}}}, 0)
+	if err := writeSchemas(dir, groups); err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "search._.db.schema.json"))
+	if err != nil {
+		t.Fatalf("expected the schema to be written: %s", err)
+	}
+	var s map[string]any
+	_ = json.Unmarshal(content, &s)
+	if s["$schema"] != jsonSchemaDraft || s["title"] != "search/*/db" {
+		t.Fatalf("unexpected schema: %s", content)
+	}
+	if items := s["properties"].(map[string]any)["hosts"].(map[string]any)["items"]; !reflect.DeepEqual(items, map[string]any{"type": "string"}) {
+		t.Fatalf("unexpected items schema: %v", items)
+	}
+}
@@ -4,6 +4,9 @@
 // else is set in this value, the login token will be read from $HOME/.vault-token.
 // * VAULT_PATH - The Vault role path to use.
 // * VAULT_ROLE - The Vault role to use for getting an auth token.
+// * VAULT_JWT_FILE - The service account token used by the "jwt" method. It is optional,
+// and defaults to the token Kubernetes mounts in every pod. The file is read again on every
+// login, so projected tokens can rotate.
 // * VAULT_CLIENT_TIMEOUT - The client timeout to use when sending requests to Vault. This is
 // optional, since the client uses a default of 60 seconds.
 //
@@ -27,32 +30,44 @@ import (
 
 const (
 	DefaultCacheTTL = 5 * time.Minute
-	MinimumCacheTTL = 30 * time.Second	
+	MinimumCacheTTL = 30 * time.Second
 )
 
 var (
 	replacer = strings.NewReplacer("/", "_", "#", "_")
+
+	// ErrNotFound is returned (wrapped) by Get when the path or the field
+	// does not exist in Vault.
+	ErrNotFound = errors.New("not found")
+
+	errNotCoercible = errors.New("value could not be coerced")
 )
 
 // NewVaultClient is a helper method to create a vault client that
 // the configuration can use.
+//
+// With VAULT_AUTH_METHOD=jwt, the client logs in again in the background as the service
+// account token rotates and before the Vault token expires. That background login is
+// only stopped by the Close method of the configuration client it is passed to with New:
+// a vault client that is closed directly with its own Close, or never passed to New,
+// keeps it running (a goroutine and a file watcher) until the process exits.
 func NewVaultClient(opts ...vault.ClientOption) *vault.Client {
 	clientOptions := []vault.ClientOption{}
 	clientOptions = append(clientOptions, opts...)
 
 	// Support either local or kubernetes based authentication
-	if os.Getenv("VAULT_AUTH_METHOD") != "jwt" {
+	jwt := os.Getenv("VAULT_AUTH_METHOD") == "jwt"
+	if !jwt {
 		if os.Getenv("VAULT_TOKEN") != "" {
 			clientOptions = append(clientOptions, vault.ClientToken(os.Getenv("VAULT_TOKEN")))
 		} else {
 			clientOptions = append(clientOptions, vault.ClientTokenPath(os.Getenv("HOME")+"/.vault-token"))
 		}
 	} else {
-		clientOptions = append(clientOptions,
-			vault.ClientRole(os.Getenv("VAULT_ROLE")),
-			vault.ClientAuthPath(os.Getenv("VAULT_PATH")),
-			vault.ClientAuthMethod(os.Getenv("VAULT_AUTH_METHOD")),
-		)
+		// Logins are done by confy rather than the sdk, so that the service account token
+		// is read again on every login and rotations are picked up right away. The
+		// placeholder token keeps the sdk from logging in on its own.
+		clientOptions = append(clientOptions, vault.ClientToken(pendingLoginToken))
 	}
 
 	client, err := vault.NewClientWithOptions(clientOptions...)
@@ -60,10 +75,23 @@ func NewVaultClient(opts ...vault.ClientOption) *vault.Client {
 		panic(err)
 	}
 
+	if jwt {
+		login := newJWTLogin(client.RawClient(), serviceAccountTokenPath(), os.Getenv("VAULT_ROLE"), os.Getenv("VAULT_PATH"))
+		ttl, err := login.loginWithin(clientTimeout())
+		if err != nil {
+			client.Close()
+			panic(err)
+		}
+		jwtLogins.Store(client, login)
+		login.start(ttl)
+	}
+
 	return client
 }
 
-type Confy interface {
+// Getter reads values. Libraries that only need to read configuration should
+// accept a Getter rather than a Confy.
+type Getter interface {
 	// Get will fetch the path from Vault.
 	// The path is in the format of a slash delimited string
 	// and uses the pound symbol to indicate a field name.
@@ -73,13 +101,20 @@ type Confy interface {
 	// Example: "scylladb/app#user"
 	// The value will be fetched from the secret/scylladb/app, and
 	// the value of the field "user" will be returned.
+	// Fields of nested documents can be reached with dots, as in
+	// "scylladb/app#pool.size".
 	//
 	// If the configuration was instantiated with envOverride==true,
 	// then it will first check the environment for the value.
 	// It does the lookup by upper-casing the path, and replacing any
 	// slashes and pound characters with underscores. If this lookup
 	// fails (i.e. returns nothing), then it will go on to lookup the
-	// value in Vault.
+	// value in Vault. Which paths may be overridden can be restricted with
+	// the WithEnvOverrideAllowlist, WithEnvOverrideDenylist and
+	// WithNoSecretOverrides options.
+	//
+	// Several alternative paths can be given, separated by "||" (see FirstOf).
+	// The first one that is found is returned.
 	Get(ctx context.Context, path string) (Value, error)
 	// GetOrDefault accepts a default value as a second parameter.
 	// It wraps around the Get method.
@@ -88,18 +123,51 @@ type Confy interface {
 	// is from Vault (true; which could mean it was overridden from the environment
 	// if envOverride==true), or the provided fallback value (false).
 	GetOrDefault(ctx context.Context, path, fallback string) (Value, bool)
+}
+
+// Watcher watches values for changes.
+type Watcher interface {
 	// Watch will poll to check if a value has changed. You have to provide the compare function
 	// and the callback that gets called if the compare function returns true.
 	// It returns a cancel function that stops the watch if called.
+	//
+	// Callbacks run on a bounded pool of workers shared by every watch (see WithCallbackWorkers).
+	// The callbacks of a watch never run concurrently, and run in the order changes were
+	// detected; changes detected while a callback is still running are coalesced, so only the
+	// latest one is delivered once it returns. A callback that panics or outlives the callback
+	// timeout is reported to the error handler (see WithErrorHandler) and does not stop the watch:
+	// once a callback times out, the watch moves on to the next change while it keeps running
+	// (see WithCallbackTimeout).
 	Watch(path string, comparator func(oldval, newval Value) bool, callback func(v Value)) context.CancelFunc
+}
+
+// Closer releases the resources held by a configuration client.
+type Closer interface {
 	// Close will stop the internal automatic expiration of items from within the cache and the automatic
 	// token renewal. Call it once you are done with the configuration client.
 	Close()
 }
 
+// Confy is the configuration client returned by New.
+type Confy interface {
+	Getter
+	Watcher
+	Closer
+}
+
 type Value interface {
 	// Raw returns the raw field value as received from Vault.
 	Raw() any
+	// IsNull reports whether the field was present but explicitly set to null.
+	IsNull() bool
+	// IsSet reports whether the value was found, either in Vault or in the
+	// environment. It is false for fallback values returned by GetOrDefault.
+	IsSet() bool
+	// IsStale reports whether the value is the last known one, returned without waiting
+	// for its document to be refreshed from Vault (see WithLatencyBudget).
+	IsStale() bool
+	// Provenance describes where the value came from.
+	Provenance() Provenance
 
 	// These methods try to coerce the value to the requested type
 	// if it does not type assert to it. If the value can't be coerced, you will
@@ -129,7 +197,9 @@ type Value interface {
 // Passing a cacheTTL of 0 will cause the DefaultCacheTTL value to be used. Also, the minimum
 // allowed cacheTTL is 30 seconds. Anything less than this will cause the MinimumCacheTTL to be
 // used instead.
-func New(client *vault.Client, cacheTTL time.Duration, envOverride bool) Confy {
+//
+// Additional behavior can be enabled by passing options (see the With* functions).
+func New(client *vault.Client, cacheTTL time.Duration, envOverride bool, opts ...Option) Confy {
 	if cacheTTL == 0 {
 		cacheTTL = DefaultCacheTTL
 	}
@@ -139,55 +209,187 @@ func New(client *vault.Client, cacheTTL time.Duration, envOverride bool) Confy {
 		cacheTTL = MinimumCacheTTL
 	}
 
-	return new(client, cacheTTL, envOverride)
+	return new(client, cacheTTL, envOverride, opts...)
 }
 
-func new(client *vault.Client, cacheTTL time.Duration, envOverride bool) Confy {
+func new(client *vault.Client, cacheTTL time.Duration, envOverride bool, opts ...Option) Confy {
 	cache := ttlcache.New(
-		ttlcache.WithTTL[string, map[string]any](cacheTTL),
+		ttlcache.WithTTL[string, loadedDocument](cacheTTL),
 	)
+	c := &confyImpl{
+		cache:       cache,
+		envOverride: envOverride,
+		client:      client,
+		ttl:         cacheTTL,
+		docs:        newDocuments(),
+		logger:      noopLogger{},
+		overrides:   envOverrides{active: map[string]Override{}, blocked: map[string]bool{}},
+		expiries:    expiries{tracked: map[expiryKey]*trackedExpiry{}},
+		callbacks:   callbackPool{workers: DefaultCallbackWorkers, timeout: DefaultCallbackTimeout},
+		history:     history{size: DefaultHistorySize},
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.backend == nil {
+		c.backend = BackendFunc(c.readKV)
+	}
+	c.validation.compile(c)
+	if c.hedger != nil && client != nil {
+		if err := c.hedger.connect(client.RawClient()); err != nil {
+			c.reportError(fmt.Errorf("could not set up hedged reads: %w", err), nil)
+		}
+	}
+	c.callbacks.slots = make(chan struct{}, c.callbacks.workers)
+	if l, ok := jwtLogins.Load(client); ok {
+		l.(*jwtLogin).setLogger(c.logger)
+	}
+
+	interceptors := append([]Interceptor(nil), c.interceptors...)
+	if envOverride {
+		interceptors = append(interceptors, c.envOverrideInterceptor)
+		c.reportOverrides()
+	}
+	c.invoke = chainInterceptors(interceptors, c.get)
+
 	go cache.Start()
-	return &confyImpl{cache: cache, envOverride: envOverride, client: client, ttl: cacheTTL}
+	if len(c.eventTypes) > 0 && client != nil {
+		c.events = newEventSubscriber(c)
+	}
+	if len(c.expiries.thresholds) > 0 {
+		go c.watchExpiries()
+	}
+	if c.metrics != nil {
+		c.watchNonSecretFields()
+	}
+
+	return c
 }
 
-func createLoader(ctx context.Context, c *vault.Client, e *error) ttlcache.Loader[string, map[string]any] {
-	return ttlcache.NewSuppressedLoader[string, map[string]any](ttlcache.LoaderFunc[string, map[string]any](func(cache *ttlcache.Cache[string, map[string]any], key string) *ttlcache.Item[string, map[string]any] { //nolint:lll
-		resp, err := c.RawClient().KVv1("secret").Get(ctx, key)
+func (c *confyImpl) createLoader(ctx context.Context, e *error) ttlcache.Loader[string, loadedDocument] {
+	return ttlcache.NewSuppressedLoader[string, loadedDocument](ttlcache.LoaderFunc[string, loadedDocument](func(cache *ttlcache.Cache[string, loadedDocument], key string) *ttlcache.Item[string, loadedDocument] { //nolint:lll
+		resp, err := c.read(ctx, key)
 		if err != nil {
-			*e = fmt.Errorf("could not get secret from Vault: %w", err)
+			if errors.Is(err, ErrNotFound) {
+				c.docs.observeMissing(key)
+			}
+			*e = err
 			return nil
 		}
 
-		return cache.Set(key, resp.Data, ttlcache.DefaultTTL)
+		data, err := decodeFields(resp.Data)
+		if err != nil {
+			*e = fmt.Errorf("could not load secret '%s': %w", key, err)
+			return nil
+		}
+
+		if err := c.validate(ctx, key, data); err != nil {
+			c.reportError(err, map[string]any{"path": key})
+			// The documents only ever see content that passed validation.
+			if last, ok := c.docs.current(key); ok {
+				return cache.Set(key, last, ttlcache.DefaultTTL)
+			}
+			*e = err
+			return nil
+		}
+
+		old := c.docs.content(key)
+		info, changed := c.docs.observe(key, data, resp.Source, resp.Version)
+		if changed {
+			c.metrics.document(info)
+			c.publishConfig(key, data)
+			c.recordHistory(key, info, old, data)
+		}
+		doc := loadedDocument{data: data, generation: info.Generation}
+		c.stale.remember(key, doc)
+		c.observeExpiries(key, data, resp.Secret)
+		return cache.Set(key, doc, ttlcache.DefaultTTL)
 	}), nil)
 }
 
+// read reads the document cached under key: a logical path if the key starts with a
+// slash (see logicalKey), or a document from the backend.
+func (c *confyImpl) read(ctx context.Context, key string) (doc *Document, err error) {
+	if strings.HasPrefix(key, "/") {
+		defer func(start time.Time) { c.metrics.request("read", key[1:], start, err) }(time.Now())
+		secret, err := c.readLogical(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return &Document{Data: secret.Data, Source: SourceVault, Secret: secret}, nil
+	}
+
+	return c.backend.Read(ctx, key)
+}
+
 type confyImpl struct {
-	cache       *ttlcache.Cache[string, map[string]any]
-	envOverride bool
-	client      *vault.Client
-	ttl         time.Duration
-	closed      bool
+	cache        *ttlcache.Cache[string, loadedDocument]
+	envOverride  bool
+	client       *vault.Client
+	backend      Backend
+	ttl          time.Duration
+	docs         *documents
+	logger       vault.Logger
+	eventTypes   []string
+	events       *eventSubscriber
+	overrides    envOverrides
+	secrets      pathPatterns
+	nonSecrets   pathPatterns
+	metrics      *metrics
+	expiries     expiries
+	identities   identityTokens
+	callbacks    callbackPool
+	validation   validator
+	stale        staleReads
+	hedger       *hedger
+	frozen       freezer
+	history      history
+	errorHandler func(error)
+	done         chan struct{}
+	closed       bool
+
+	interceptors      []Interceptor
+	watchInterceptors []WatchInterceptor
+	invoke            Invoker
 }
 
 func (c *confyImpl) Close() {
 	if !c.closed {
+		close(c.done)
+		c.events.close()
+		if l, ok := jwtLogins.LoadAndDelete(c.client); ok {
+			l.(*jwtLogin).stop()
+		}
 		c.cache.Stop()
-		c.client.Close()
+		if c.client != nil {
+			c.client.Close()
+		}
 		c.closed = true
 	}
 }
 
-func (c *confyImpl) Get(ctx context.Context, path string) (Value, error) {
+// documentPath returns the path of the document a Get path refers to, without
+// the secret/ prefix and the field name.
+func documentPath(path string) string {
 	path = strings.TrimPrefix(path, "secret/")
-	if c.envOverride {
-		envKey := strings.ToUpper(replacer.Replace(path))
-		envValue := os.Getenv(envKey)
-		if envValue != "" {
-			return &value{val: envValue}, nil
-		}
+	if i := strings.Index(path, "#"); i >= 0 {
+		path = path[:i]
 	}
 
+	return path
+}
+
+func (c *confyImpl) Get(ctx context.Context, path string) (Value, error) {
+	if strings.Contains(path, alternativeSeparator) {
+		return c.getFirst(ctx, alternatives(path))
+	}
+
+	return c.invoke(ctx, strings.TrimPrefix(path, "secret/"))
+}
+
+// get reads path from the cache, loading its document from Vault if needed.
+func (c *confyImpl) get(ctx context.Context, path string) (Value, error) {
 	parts := strings.SplitN(path, "#", 2)
 	path = parts[0]
 	var fieldName string
@@ -195,53 +397,100 @@ func (c *confyImpl) Get(ctx context.Context, path string) (Value, error) {
 		fieldName = parts[1]
 	}
 
-	var errBucket error
-	loader := createLoader(ctx, c.client, &errBucket)
-	v := c.cache.Get(path, ttlcache.WithLoader(loader))
-	if v == nil {
-		if errBucket != nil {
-			return nil, errBucket
-		} else {
-			return nil, errors.New("no value found")
-		}
+	return c.load(ctx, path, fieldName)
+}
+
+// load reads the document cached under key, loading it from Vault if needed, and
+// extracts fieldName from it unless it is empty.
+func (c *confyImpl) load(ctx context.Context, key, fieldName string) (Value, error) {
+	path := key
+	doc, stale, err := c.loadDocument(ctx, path)
+	if err != nil {
+		return nil, err
 	}
+	data := doc.data
 
+	o := &origin{docs: c.docs, path: path, field: fieldName, generation: doc.generation}
+	getPath := strings.TrimPrefix(path, "/")
+	if fieldName != "" {
+		getPath += "#" + fieldName
+	}
+	prov := c.docs.provenance(path, getPath)
 	if fieldName != "" {
-		if f, ok := v.Value()[fieldName]; ok {
-			return &value{val: f}, nil
+		if f, ok := lookupField(data, fieldName); ok {
+			return &value{val: f, set: true, stale: stale, origin: o, provenance: prov}, nil
 		} else {
-			return nil, fmt.Errorf("field '%s' on path '%s' was not found", fieldName, path)
+			return nil, fmt.Errorf("field '%s' on path '%s' was %w", fieldName, path, ErrNotFound)
 		}
 	}
 
-	return &value{val: v.Value()}, nil
+	return &value{val: data, set: true, stale: stale, origin: o, provenance: prov}, nil
+}
+
+func (c *confyImpl) Documents() []DocumentInfo {
+	return c.docs.list()
 }
 
 func (c *confyImpl) GetOrDefault(ctx context.Context, path, fallback string) (Value, bool) {
 	v, err := c.Get(ctx, path)
 	if err != nil {
-		return &value{val: fallback}, false
+		return &value{val: fallback, provenance: Provenance{Source: SourceDefault, Path: path}}, false
 	}
 
 	return v, true
 }
 
 type value struct {
-	val any
+	val        any
+	set        bool
+	stale      bool
+	origin     *origin
+	provenance Provenance
 }
 
-func (v *value) String() string {
-	if s, ok := v.val.(string); ok {
+// StringValue returns a Value holding s, so that content that does not come from a
+// configuration client, such as a key read from a file, can be parsed with helpers
+// like PrivateKey. Its provenance is empty.
+func StringValue(s string) Value {
+	return &value{val: s, set: true}
+}
+
+// stringify formats a raw value as a string, turning nulls into the empty string.
+func stringify(val any) string {
+	switch s := val.(type) {
+	case nil:
+		return ""
+	case string:
 		return s
 	}
 
-	return fmt.Sprintf("%s", v.val)
+	return fmt.Sprintf("%s", val)
+}
+
+func (v *value) String() string {
+	return stringify(v.val)
 }
 
 func (v *value) Raw() any {
 	return v.val
 }
 
+func (v *value) IsNull() bool {
+	return v.set && v.val == nil
+}
+
+func (v *value) IsSet() bool {
+	return v.set
+}
+
+func (v *value) IsStale() bool {
+	return v.stale
+}
+
+func (v *value) Provenance() Provenance {
+	return v.provenance
+}
+
 func (v *value) Data() (map[string]any, bool) {
 	m, ok := v.val.(map[string]any)
 	return m, ok
@@ -309,39 +558,38 @@ func (v *value) Map() (map[string]string, bool) {
 
 	ms := make(map[string]string, len(ma))
 	for k, v := range ma {
-		str, ok := v.(string)
-		if !ok {
-			ms[k] = fmt.Sprintf("%s", v)
-		} else {
-			ms[k] = str
-		}
+		ms[k] = stringify(v)
 	}
 
 	return ms, true
 }
 
 func (v *value) StringSlice() ([]string, bool) {
-	vals, ok := v.val.([]any)
-	if !ok {
-		return []string{}, false
-	}
-
-	strs := make([]string, len(vals))
-	for i, val := range vals {
-		s, ok := val.(string)
+	strs, err := Memoize(v, "confy.string-slice", func(Value) ([]string, error) {
+		vals, ok := v.val.([]any)
 		if !ok {
-			strs[i] = fmt.Sprintf("%s", val)
-		} else {
-			strs[i] = s
+			return []string{}, errNotCoercible
 		}
+
+		strs := make([]string, len(vals))
+		for i, val := range vals {
+			strs[i] = stringify(val)
+		}
+
+		return strs, nil
+	})
+	if err != nil {
+		return []string{}, false
 	}
 
-	return strs, true
+	// The memoized slice is shared, so hand out a copy.
+	return append([]string(nil), strs...), true
 }
 
 func (v *value) Duration() (time.Duration, bool) {
-	s := v.String()
-	d, err := time.ParseDuration(s)
+	d, err := Memoize(v, "confy.duration", func(v Value) (time.Duration, error) {
+		return time.ParseDuration(v.String())
+	})
 	if err != nil {
 		return time.Duration(0), false
 	}
@@ -353,33 +601,56 @@ func (v *value) Duration() (time.Duration, bool) {
 // and the callback that gets called if the compare function returns true.
 // It returns a cancel function that stops the watch if called.
 func (c *confyImpl) Watch(path string, comparator func(oldval, newval Value) bool, callback func(v Value)) context.CancelFunc {
+	return c.watch(path, documentPaths(path), c.Get, comparator, callback)
+}
+
+// watch polls path with get, and checks it right away when an event arrives for one of
+// the documents cached under keys.
+func (c *confyImpl) watch(path string, keys []string, get Invoker, comparator func(oldval, newval Value) bool, callback func(v Value)) context.CancelFunc {
 	// start polling goroutine with select
 	// return function that will push signal to kill thread
 	stopChan := make(chan struct{})
+	// Vault events (if enabled) trigger a check right away, instead of waiting for the next poll.
+	notify, unlisten := c.events.listen(keys...)
+	callbacks := c.newCallbackQueue(path, callback)
 	go func() {
-		oldValue, err := c.Get(context.Background(), path)
+		defer unlisten()
+		oldValue, err := get(context.Background(), path)
 		if err != nil {
 			oldValue = &value{val: ""}
 		}
+		check := func() {
+			if c.Frozen() {
+				return
+			}
+			newValue, err := get(context.Background(), path)
+			if err != nil {
+				return
+			}
+			if comparator(oldValue, newValue) {
+				callbacks.submit(newValue)
+			}
+			oldValue = newValue
+		}
 	OuterLoop:
 		for {
 			select {
 			case <-time.After(c.ttl + (time.Second)):
-				newValue, err := c.Get(context.Background(), path)
-				if err != nil {
-					break
-				}
-				if comparator(oldValue, newValue) {
-					callback(newValue)
-				}
-				oldValue = newValue
+				check()
+			case <-notify:
+				check()
 			case <-stopChan:
 				break OuterLoop
+			case <-c.done:
+				break OuterLoop
 			}
 		}
 	}()
 
 	return func() {
-		stopChan <- struct{}{}
+		select {
+		case stopChan <- struct{}{}:
+		case <-c.done:
+		}
 	}
 }
@@ -380,6 +380,21 @@ func TestConfy(t *testing.T) {
 		}
 	})
 
+	t.Run("we can tell a null value apart", func(t *testing.T) {
+		v, err := config.Get(ctx, "test/types#n")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+
+		if !v.IsNull() {
+			t.Fatalf("expected a null value")
+		}
+
+		if v.String() != "" {
+			t.Fatalf("expected an empty string; got '%s'", v.String())
+		}
+	})
+
 	t.Run("we can get the expected integer from the raw value", func(t *testing.T) {
 		v, err := config.Get(ctx, "test/types#i")
 		if err != nil {
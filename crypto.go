@@ -0,0 +1,198 @@
+package confy
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// PEM block types understood by the key and certificate helpers.
+const (
+	pemCertificate       = "CERTIFICATE"
+	pemPrivateKey        = "PRIVATE KEY"
+	pemRSAPrivateKey     = "RSA PRIVATE KEY"
+	pemECPrivateKey      = "EC PRIVATE KEY"
+	pemOpenSSHPrivateKey = "OPENSSH PRIVATE KEY"
+	pemPublicKey         = "PUBLIC KEY"
+	pemRSAPublicKey      = "RSA PUBLIC KEY"
+)
+
+// The helpers below parse cryptographic material stored in Vault fields. Parsed objects
+// are cached for the generation of the document the value was read from, so calling
+// them on every request is cheap. Returned objects are shared and must not be modified.
+
+// PEMBlocks decodes every PEM block in the value. It fails if the value contains no PEM data.
+func PEMBlocks(v Value) ([]*pem.Block, error) {
+	return Memoize(v, "confy.pem", func(v Value) ([]*pem.Block, error) {
+		rest := []byte(v.String())
+		blocks := []*pem.Block{}
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			blocks = append(blocks, block)
+		}
+
+		if len(blocks) == 0 {
+			return nil, errors.New("no PEM data found in value")
+		}
+
+		return blocks, nil
+	})
+}
+
+// Certificates parses the value as a PEM encoded certificate chain. Every block in the
+// value must be a CERTIFICATE block.
+func Certificates(v Value) ([]*x509.Certificate, error) {
+	return Memoize(v, "confy.x509", func(v Value) ([]*x509.Certificate, error) {
+		blocks, err := PEMBlocks(v)
+		if err != nil {
+			return nil, err
+		}
+
+		certs := make([]*x509.Certificate, 0, len(blocks))
+		for i, block := range blocks {
+			if block.Type != pemCertificate {
+				return nil, fmt.Errorf("PEM block %d is of type '%s'; expected '%s'", i, block.Type, pemCertificate)
+			}
+
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse certificate in PEM block %d: %w", i, err)
+			}
+			certs = append(certs, cert)
+		}
+
+		return certs, nil
+	})
+}
+
+// PrivateKey parses the first PEM block of the value as a private key. PKCS#1 RSA,
+// PKCS#8, SEC 1 EC and OpenSSH private keys are supported. The returned key is one of
+// *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey.
+func PrivateKey(v Value) (crypto.PrivateKey, error) {
+	return Memoize(v, "confy.private-key", func(v Value) (crypto.PrivateKey, error) {
+		blocks, err := PEMBlocks(v)
+		if err != nil {
+			return nil, err
+		}
+
+		block := blocks[0]
+		var key crypto.PrivateKey
+		switch block.Type {
+		case pemRSAPrivateKey:
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case pemPrivateKey:
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case pemECPrivateKey:
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case pemOpenSSHPrivateKey:
+			var raw any
+			raw, err = ssh.ParseRawPrivateKey(pem.EncodeToMemory(block))
+			key = dereferenceKey(raw)
+		default:
+			return nil, fmt.Errorf("PEM block of type '%s' is not a private key", block.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", strings.ToLower(block.Type), err)
+		}
+
+		return key, nil
+	})
+}
+
+// PublicKey parses the value as a public key. It accepts PKIX ("PUBLIC KEY") and PKCS#1
+// ("RSA PUBLIC KEY") PEM blocks, a certificate (whose public key is returned), or a key
+// in the SSH authorized_keys format. The key of an SSH certificate is returned.
+func PublicKey(v Value) (crypto.PublicKey, error) {
+	return Memoize(v, "confy.public-key", func(v Value) (crypto.PublicKey, error) {
+		blocks, err := PEMBlocks(v)
+		if err != nil {
+			// Not PEM encoded, so try the SSH authorized_keys format instead.
+			key, sshErr := SSHPublicKey(v)
+			if sshErr != nil {
+				return nil, errors.New("value is neither a PEM encoded nor an SSH public key")
+			}
+			if cert, ok := key.(*ssh.Certificate); ok {
+				key = cert.Key
+			}
+			cryptoKey, ok := key.(ssh.CryptoPublicKey)
+			if !ok {
+				return nil, fmt.Errorf("SSH key of type %s has no crypto public key", key.Type())
+			}
+			return cryptoKey.CryptoPublicKey(), nil
+		}
+
+		block := blocks[0]
+		switch block.Type {
+		case pemPublicKey:
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse public key: %w", err)
+			}
+			return key, nil
+		case pemRSAPublicKey:
+			key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse rsa public key: %w", err)
+			}
+			return key, nil
+		case pemCertificate:
+			certs, err := Certificates(v)
+			if err != nil {
+				return nil, err
+			}
+			return certs[0].PublicKey, nil
+		}
+
+		return nil, fmt.Errorf("PEM block of type '%s' is not a public key", block.Type)
+	})
+}
+
+// SSHSigner parses the value as an SSH private key in any of the formats supported
+// by PrivateKey.
+func SSHSigner(v Value) (ssh.Signer, error) {
+	return Memoize(v, "confy.ssh-signer", func(v Value) (ssh.Signer, error) {
+		key, err := PrivateKey(v)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("could not create ssh signer: %w", err)
+		}
+
+		return signer, nil
+	})
+}
+
+// SSHPublicKey parses the value as an SSH public key in the authorized_keys format.
+func SSHPublicKey(v Value) (ssh.PublicKey, error) {
+	return Memoize(v, "confy.ssh-public-key", func(v Value) (ssh.PublicKey, error) {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(v.String()))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse ssh public key: %w", err)
+		}
+
+		return key, nil
+	})
+}
+
+// dereferenceKey normalizes ed25519 keys returned by the ssh package as pointers, so
+// that every helper returns keys the same way the x509 package does.
+func dereferenceKey(key any) crypto.PrivateKey {
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		return *k
+	}
+
+	return key
+}
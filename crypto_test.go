@@ -0,0 +1,183 @@
+package confy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestCryptoHelpers(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate rsa key: %s", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate ec key: %s", err)
+	}
+	ecDER, _ := x509.MarshalECPrivateKey(ecKey)
+	pkcs8DER, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	pkixDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	sshPub, _ := ssh.NewPublicKey(&rsaKey.PublicKey)
+	sshCASigner, _ := ssh.NewSignerFromKey(ecKey)
+	sshCert := &ssh.Certificate{Key: sshPub, CertType: ssh.UserCert, ValidBefore: ssh.CertTimeInfinity}
+	if err := sshCert.SignCert(rand.Reader, sshCASigner); err != nil {
+		t.Fatalf("could not sign ssh certificate: %s", err)
+	}
+	// Security keys have no crypto.PublicKey counterpart.
+	skPub := "sk-ssh-ed25519@openssh.com " + base64.StdEncoding.EncodeToString(ssh.Marshal(struct {
+		Name        string
+		Key         []byte
+		Application string
+	}{"sk-ssh-ed25519@openssh.com", make([]byte, ed25519.PublicKeySize), "ssh:"}))
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "confy"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &ecKey.PublicKey, ecKey)
+	if err != nil {
+		t.Fatalf("could not create certificate: %s", err)
+	}
+
+	encode := func(typ string, der []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}))
+	}
+
+	fake := newFakeVault(t, map[string]map[string]any{
+		"test/crypto": {
+			"cert":    encode("CERTIFICATE", certDER) + encode("CERTIFICATE", certDER),
+			"pkcs1":   encode("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)),
+			"pkcs8":   encode("PRIVATE KEY", pkcs8DER),
+			"ec":      encode("EC PRIVATE KEY", ecDER),
+			"pub":     encode("PUBLIC KEY", pkixDER),
+			"ssh":     string(ssh.MarshalAuthorizedKey(sshPub)),
+			"sshcert": string(ssh.MarshalAuthorizedKey(sshCert)),
+			"sk":      skPub,
+			"plain":   "not pem",
+			"broken":  encode("CERTIFICATE", []byte("garbage")),
+		},
+	})
+	config := New(fake.client(t), time.Minute, false)
+	defer config.Close()
+	ctx := context.Background()
+
+	get := func(path string) Value {
+		v, err := config.Get(ctx, path)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		return v
+	}
+
+	t.Run("certificate chain", func(t *testing.T) {
+		certs, err := Certificates(get("test/crypto#cert"))
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if len(certs) != 2 || certs[0].Subject.CommonName != "confy" {
+			t.Fatalf("did not get the expected certificate chain")
+		}
+
+		key, err := PublicKey(get("test/crypto#cert"))
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if _, ok := key.(*ecdsa.PublicKey); !ok {
+			t.Fatalf("expected an ecdsa public key; got %T", key)
+		}
+	})
+
+	t.Run("private keys", func(t *testing.T) {
+		for field, check := range map[string]func(any) bool{
+			"pkcs1": func(k any) bool { _, ok := k.(*rsa.PrivateKey); return ok },
+			"pkcs8": func(k any) bool { _, ok := k.(*rsa.PrivateKey); return ok },
+			"ec":    func(k any) bool { _, ok := k.(*ecdsa.PrivateKey); return ok },
+		} {
+			key, err := PrivateKey(get("test/crypto#" + field))
+			if err != nil {
+				t.Fatalf("did not expect an error on %s: %s", field, err)
+			}
+			if !check(key) {
+				t.Fatalf("unexpected key type %T on %s", key, field)
+			}
+		}
+
+		if _, err := SSHSigner(get("test/crypto#pkcs1")); err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+	})
+
+	t.Run("string values", func(t *testing.T) {
+		key, err := PrivateKey(StringValue(encode("EC PRIVATE KEY", ecDER)))
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if _, ok := key.(*ecdsa.PrivateKey); !ok {
+			t.Fatalf("unexpected key type %T", key)
+		}
+	})
+
+	t.Run("public keys", func(t *testing.T) {
+		if _, err := PublicKey(get("test/crypto#pub")); err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+
+		key, err := PublicKey(get("test/crypto#ssh"))
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if _, ok := key.(*rsa.PublicKey); !ok {
+			t.Fatalf("expected an rsa public key; got %T", key)
+		}
+
+		key, err = PublicKey(get("test/crypto#sshcert"))
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if _, ok := key.(*rsa.PublicKey); !ok {
+			t.Fatalf("expected the rsa public key of the certificate; got %T", key)
+		}
+
+		if _, err := PublicKey(get("test/crypto#sk")); err == nil {
+			t.Fatalf("expected an error on a security key")
+		}
+	})
+
+	t.Run("mismatched types", func(t *testing.T) {
+		if _, err := Certificates(get("test/crypto#pkcs1")); err == nil {
+			t.Fatalf("expected an error parsing a private key as a certificate")
+		}
+		if _, err := PrivateKey(get("test/crypto#cert")); err == nil {
+			t.Fatalf("expected an error parsing a certificate as a private key")
+		}
+		if _, err := PEMBlocks(get("test/crypto#plain")); err == nil {
+			t.Fatalf("expected an error on non PEM data")
+		}
+		if _, err := Certificates(get("test/crypto#broken")); err == nil {
+			t.Fatalf("expected an error on a broken certificate")
+		}
+	})
+
+	t.Run("parsed objects are cached", func(t *testing.T) {
+		first, _ := Certificates(get("test/crypto#cert"))
+		second, _ := Certificates(get("test/crypto#cert"))
+		if first[0] != second[0] {
+			t.Fatalf("expected the parsed certificate to be reused")
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package confy
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+)
+
+// View is a configuration client that can be read and watched, but not closed.
+type View interface {
+	Getter
+	Watcher
+}
+
+// ReadOnly returns a view of c that can be handed to code that must not be able
+// to close the shared client. Unlike NopCloser, the view does not implement Closer at all.
+func ReadOnly(c View) View {
+	return &readOnly{getter: c, watcher: c}
+}
+
+type readOnly struct {
+	getter  Getter
+	watcher Watcher
+}
+
+func (r *readOnly) Get(ctx context.Context, path string) (Value, error) {
+	return r.getter.Get(ctx, path)
+}
+
+func (r *readOnly) GetOrDefault(ctx context.Context, path, fallback string) (Value, bool) {
+	return r.getter.GetOrDefault(ctx, path, fallback)
+}
+
+func (r *readOnly) Watch(path string, comparator func(oldval, newval Value) bool, callback func(v Value)) context.CancelFunc {
+	return r.watcher.Watch(path, comparator, callback)
+}
+
+// NopCloser returns a Confy whose Close method does nothing, for code that insists
+// on closing the client it is given.
+func NopCloser(c View) Confy {
+	return nopCloser{View: c}
+}
+
+type nopCloser struct {
+	View
+}
+
+func (nopCloser) Close() {}
+
+// Prefixed returns a view of c scoped to prefix. Every path read or watched through it
+// is prepended with prefix, so Prefixed(c, "search/prod").Get(ctx, "app#user") reads
+// "search/prod/app#user".
+func Prefixed(c View, prefix string) View {
+	prefix = strings.TrimSuffix(strings.TrimPrefix(prefix, "secret/"), "/") + "/"
+	return &prefixed{view: c, prefix: prefix}
+}
+
+type prefixed struct {
+	view   View
+	prefix string
+}
+
+func (p *prefixed) path(path string) string {
+	paths := alternatives(path)
+	for i, path := range paths {
+		paths[i] = p.prefix + strings.TrimPrefix(strings.TrimPrefix(path, "secret/"), "/")
+	}
+
+	return FirstOf(paths...)
+}
+
+func (p *prefixed) Get(ctx context.Context, path string) (Value, error) {
+	return p.view.Get(ctx, p.path(path))
+}
+
+func (p *prefixed) GetOrDefault(ctx context.Context, path, fallback string) (Value, bool) {
+	return p.view.GetOrDefault(ctx, p.path(path), fallback)
+}
+
+func (p *prefixed) Watch(path string, comparator func(oldval, newval Value) bool, callback func(v Value)) context.CancelFunc {
+	return p.view.Watch(p.path(path), comparator, callback)
+}
+
+// Cached returns a Getter that caches the values returned by g for ttl, by path.
+// Errors are not cached. It is meant for Getter implementations that have no cache
+// of their own; the clients returned by New already cache documents.
+func Cached(g Getter, ttl time.Duration) Getter {
+	return &cached{
+		getter: g,
+		// Expired items are skipped on read, so the cache does not need to be started.
+		cache: ttlcache.New(
+			ttlcache.WithTTL[string, Value](ttl),
+			ttlcache.WithDisableTouchOnHit[string, Value](),
+		),
+	}
+}
+
+type cached struct {
+	getter Getter
+	cache  *ttlcache.Cache[string, Value]
+}
+
+func (c *cached) Get(ctx context.Context, path string) (Value, error) {
+	if item := c.cache.Get(path); item != nil {
+		return item.Value(), nil
+	}
+
+	v, err := c.getter.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Set(path, v, ttlcache.DefaultTTL)
+
+	return v, nil
+}
+
+func (c *cached) GetOrDefault(ctx context.Context, path, fallback string) (Value, bool) {
+	v, err := c.Get(ctx, path)
+	if err != nil {
+		return &value{val: fallback, provenance: Provenance{Source: SourceDefault, Path: path}}, false
+	}
+
+	return v, true
+}
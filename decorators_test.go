@@ -0,0 +1,85 @@
+package confy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingGetter is a Getter that counts the reads that reach it.
+type countingGetter struct {
+	reads int
+}
+
+func (g *countingGetter) Get(_ context.Context, path string) (Value, error) {
+	g.reads++
+	if path == "missing" {
+		return nil, ErrNotFound
+	}
+	return &value{val: path, set: true}, nil
+}
+
+func (g *countingGetter) GetOrDefault(ctx context.Context, path, fallback string) (Value, bool) {
+	v, err := g.Get(ctx, path)
+	if err != nil {
+		return &value{val: fallback}, false
+	}
+	return v, true
+}
+
+func TestDecorators(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"search/prod/app": {"user": "prod-user"},
+	})
+	config := New(fake.client(t), time.Minute, false)
+	defer config.Close()
+	ctx := context.Background()
+
+	t.Run("read only view", func(t *testing.T) {
+		view := ReadOnly(config)
+		if _, ok := view.(Closer); ok {
+			t.Fatalf("did not expect a read only view to be closable")
+		}
+		if _, err := view.Get(ctx, "search/prod/app#user"); err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+	})
+
+	t.Run("nop closer", func(t *testing.T) {
+		NopCloser(config).Close()
+		if config.(*confyImpl).closed {
+			t.Fatalf("did not expect the underlying client to be closed")
+		}
+	})
+
+	t.Run("prefixed view", func(t *testing.T) {
+		v, err := Prefixed(config, "secret/search/prod/").Get(ctx, "app#user")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if v.String() != "prod-user" {
+			t.Fatalf("expected 'prod-user'; got '%s'", v.String())
+		}
+	})
+
+	t.Run("cached getter", func(t *testing.T) {
+		inner := &countingGetter{}
+		g := Cached(inner, time.Minute)
+		for i := 0; i < 3; i++ {
+			if v, err := g.Get(ctx, "a"); err != nil || v.String() != "a" {
+				t.Fatalf("unexpected result: %v, %v", v, err)
+			}
+		}
+		if inner.reads != 1 {
+			t.Fatalf("expected a single read; got %d", inner.reads)
+		}
+
+		if v, ok := g.GetOrDefault(ctx, "missing", "fallback"); ok || v.String() != "fallback" {
+			t.Fatalf("expected the fallback value")
+		}
+		g.GetOrDefault(ctx, "missing", "fallback")
+		if inner.reads != 3 {
+			t.Fatalf("did not expect errors to be cached; got %d reads", inner.reads)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package confy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Field name suffixes that mark a field as encoded. Vault KV values have size limits,
+// so large documents can be stored compressed and base64 encoded in a single field.
+// The field is decoded when the document is loaded, and made available under its name
+// without the suffix (e.g. "settings.b64gz" is read as "settings"). If the decoded
+// content is a JSON object or array, it is parsed, so its fields can be reached with
+// dotted field names (e.g. "app#settings.pool.size"). Anything else, including JSON
+// scalars like "42" or "true", is kept as a string.
+const (
+	encodingBase64     = ".b64"
+	encodingBase64Gzip = ".b64gz"
+)
+
+// decodeFields returns a copy of data with every encoded field decoded. Documents
+// without encoded fields are returned as is. It is an error for several fields to
+// provide the same name, such as "settings" and "settings.b64gz".
+func decodeFields(data map[string]any) (map[string]any, error) {
+	encoded := false
+	for k := range data {
+		if strings.HasSuffix(k, encodingBase64) || strings.HasSuffix(k, encodingBase64Gzip) {
+			encoded = true
+			break
+		}
+	}
+	if !encoded {
+		return data, nil
+	}
+
+	decoded := make(map[string]any, len(data))
+	sources := make(map[string]string, len(data))
+	for k, v := range data {
+		var (
+			name string
+			val  any
+			err  error
+		)
+		switch {
+		case strings.HasSuffix(k, encodingBase64Gzip):
+			name = strings.TrimSuffix(k, encodingBase64Gzip)
+			val, err = decodeField(v, true)
+		case strings.HasSuffix(k, encodingBase64):
+			name = strings.TrimSuffix(k, encodingBase64)
+			val, err = decodeField(v, false)
+		default:
+			name, val = k, v
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not decode field '%s': %w", k, err)
+		}
+		if other, ok := sources[name]; ok {
+			fields := []string{other, k}
+			sort.Strings(fields)
+			return nil, fmt.Errorf("fields '%s' and '%s' both provide field '%s'", fields[0], fields[1], name)
+		}
+		sources[name] = k
+		decoded[name] = val
+	}
+
+	return decoded, nil
+}
+
+func decodeField(v any, gzipped bool) (any, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a base64 string; got %T", v)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+
+	if gzipped {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		if b, err = io.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if t := bytes.TrimSpace(b); len(t) == 0 || (t[0] != '{' && t[0] != '[') {
+		return string(b), nil
+	}
+
+	// Keep numbers as json.Number, like documents received from Vault.
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil || dec.More() {
+		return string(b), nil
+	}
+
+	return doc, nil
+}
+
+// lookupField finds field in doc. A field name that does not exist as is is split
+// on dots to traverse nested documents, so "a.b.c" can match doc["a"]["b"]["c"]
+// as well as doc["a.b"]["c"].
+func lookupField(doc map[string]any, field string) (any, bool) {
+	if v, ok := doc[field]; ok {
+		return v, true
+	}
+
+	for i := 0; i < len(field); i++ {
+		if field[i] != '.' {
+			continue
+		}
+
+		if sub, ok := doc[field[:i]].(map[string]any); ok {
+			if v, ok := lookupField(sub, field[i+1:]); ok {
+				return v, true
+			}
+		}
+	}
+
+	return nil, false
+}
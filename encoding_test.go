@@ -0,0 +1,96 @@
+package confy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodedFields(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte(`{"pool": {"size": 12}, "name": "big"}`))
+	_ = zw.Close()
+
+	fake := newFakeVault(t, map[string]map[string]any{
+		"test/encoded": {
+			"settings.b64gz": base64.StdEncoding.EncodeToString(buf.Bytes()),
+			"motd.b64":       base64.StdEncoding.EncodeToString([]byte("hello")),
+			"plain":          "as is",
+			"null.b64":       base64.StdEncoding.EncodeToString([]byte("null")),
+			"flag.b64":       base64.StdEncoding.EncodeToString([]byte("true")),
+			"count.b64":      base64.StdEncoding.EncodeToString([]byte(" 42 ")),
+		},
+		"test/broken": {"settings.b64gz": "not base64!"},
+		"test/collision": {
+			"settings":       "plain",
+			"settings.b64gz": base64.StdEncoding.EncodeToString(buf.Bytes()),
+		},
+	})
+	config := New(fake.client(t), time.Minute, false)
+	defer config.Close()
+	ctx := context.Background()
+
+	t.Run("decoded document traversal", func(t *testing.T) {
+		v, err := config.Get(ctx, "test/encoded#settings.pool.size")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if i, ok := v.Int(); !ok || i != 12 {
+			t.Fatalf("expected 12; got '%s'", v.String())
+		}
+
+		v, err = config.Get(ctx, "test/encoded#settings")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if m, ok := v.Map(); !ok || m["name"] != "big" {
+			t.Fatalf("expected a decoded document; got %T", v.Raw())
+		}
+	})
+
+	t.Run("decoded string", func(t *testing.T) {
+		v, err := config.Get(ctx, "test/encoded#motd")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if v.String() != "hello" {
+			t.Fatalf("expected 'hello'; got '%s'", v.String())
+		}
+	})
+
+	t.Run("decoded json scalars stay strings", func(t *testing.T) {
+		for field, want := range map[string]string{"null": "null", "flag": "true", "count": " 42 "} {
+			v, err := config.Get(ctx, "test/encoded#"+field)
+			if err != nil {
+				t.Fatalf("did not expect an error for '%s': %s", field, err)
+			}
+			if s, ok := v.Raw().(string); !ok || s != want {
+				t.Fatalf("expected the string '%s' for '%s'; got %T '%v'", want, field, v.Raw(), v.Raw())
+			}
+		}
+	})
+
+	t.Run("missing nested field", func(t *testing.T) {
+		if _, err := config.Get(ctx, "test/encoded#settings.pool.nope"); err == nil {
+			t.Fatalf("expected an error")
+		}
+	})
+
+	t.Run("broken encoding", func(t *testing.T) {
+		if _, err := config.Get(ctx, "test/broken#settings"); err == nil {
+			t.Fatalf("expected an error")
+		}
+	})
+
+	t.Run("name collision", func(t *testing.T) {
+		_, err := config.Get(ctx, "test/collision#settings")
+		if err == nil || !strings.Contains(err.Error(), "fields 'settings' and 'settings.b64gz' both provide field 'settings'") {
+			t.Fatalf("expected a collision error; got %v", err)
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package confy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultEventTypes are the Vault event types subscribed to by WithEventNotifications
+// when none are given. They cover writes and deletes on the KV v1 engine confy reads from.
+var DefaultEventTypes = []string{"kv-v1/data-write", "kv-v1/delete"}
+
+const (
+	eventsMinBackoff = time.Second
+	eventsMaxBackoff = time.Minute
+)
+
+// WithEventNotifications makes watches react to changes as soon as Vault reports them,
+// instead of waiting for the next poll. The client subscribes to the given event types
+// (DefaultEventTypes if none are given) through Vault's sys/events/subscribe WebSocket
+// endpoint, available in Vault 1.13 and later. When an event for a watched document
+// arrives, the document is dropped from the cache and the watch callbacks fire right away.
+//
+// Polling keeps running regardless, so watches fall back to it whenever the event stream
+// is not available (e.g. older Vault servers, or missing policy capabilities).
+func WithEventNotifications(eventTypes ...string) Option {
+	return func(c *confyImpl) {
+		if len(eventTypes) == 0 {
+			eventTypes = DefaultEventTypes
+		}
+		c.eventTypes = eventTypes
+	}
+}
+
+// eventSubscriber keeps a WebSocket connection per event type open against Vault and
+// notifies the watches registered for the paths that change.
+type eventSubscriber struct {
+	c         *confyImpl
+	ctx       context.Context
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+	listeners map[string]map[chan struct{}]struct{}
+}
+
+// vaultEvent is the part of the CloudEvents envelope sent by Vault that we care about.
+type vaultEvent struct {
+	Data struct {
+		EventType string `json:"event_type"`
+		Event     struct {
+			Metadata struct {
+				Path string `json:"path"`
+			} `json:"metadata"`
+		} `json:"event"`
+		PluginInfo struct {
+			MountPath string `json:"mount_path"`
+		} `json:"plugin_info"`
+	} `json:"data"`
+}
+
+func newEventSubscriber(c *confyImpl) *eventSubscriber {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &eventSubscriber{c: c, ctx: ctx, cancel: cancel, listeners: map[string]map[chan struct{}]struct{}{}}
+	for _, eventType := range c.eventTypes {
+		go s.subscribe(eventType)
+	}
+	return s
+}
+
+// listen returns a channel that receives a signal every time an event arrives for one
+// of the documents at paths, and a function to stop listening. It is safe to call on a
+// nil subscriber, in which case the channel never fires.
+func (s *eventSubscriber) listen(paths ...string) (<-chan struct{}, func()) {
+	if s == nil {
+		return nil, func() {}
+	}
+
+	ch := make(chan struct{}, 1)
+	s.mu.Lock()
+	for _, path := range paths {
+		if s.listeners[path] == nil {
+			s.listeners[path] = map[chan struct{}]struct{}{}
+		}
+		s.listeners[path][ch] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, path := range paths {
+			delete(s.listeners[path], ch)
+			if len(s.listeners[path]) == 0 {
+				delete(s.listeners, path)
+			}
+		}
+	}
+}
+
+func (s *eventSubscriber) close() {
+	if s != nil {
+		s.cancel()
+	}
+}
+
+// subscribe keeps a subscription to eventType open until the subscriber is closed,
+// reconnecting with an exponential backoff.
+func (s *eventSubscriber) subscribe(eventType string) {
+	backoff := eventsMinBackoff
+	for {
+		connected, err := s.stream(eventType)
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		if connected {
+			backoff = eventsMinBackoff
+		}
+		s.c.logger.Warn("vault event stream unavailable; watches fall back to polling", map[string]any{
+			"event_type": eventType,
+			"err":        err,
+			"retry_in":   backoff.String(),
+		})
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > eventsMaxBackoff {
+			backoff = eventsMaxBackoff
+		}
+	}
+}
+
+// stream reads events from a single connection until it fails. It reports whether
+// the connection was established at all.
+func (s *eventSubscriber) stream(eventType string) (bool, error) {
+	raw := s.c.client.RawClient()
+	u, err := url.Parse(raw.Address())
+	if err != nil {
+		return false, err
+	}
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/sys/events/subscribe/" + eventType
+	u.RawQuery = "json=true"
+
+	header := http.Header{}
+	header.Set("X-Vault-Token", raw.Token())
+	if ns := raw.Namespace(); ns != "" {
+		header.Set("X-Vault-Namespace", ns)
+	}
+
+	dialer := *websocket.DefaultDialer
+	if t, ok := raw.CloneConfig().HttpClient.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = t.TLSClientConfig
+	}
+
+	conn, resp, err := dialer.DialContext(s.ctx, u.String(), header)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	s.c.logger.Info("subscribed to vault events", map[string]any{"event_type": eventType})
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+
+		var event vaultEvent
+		if err := json.Unmarshal(msg, &event); err != nil {
+			s.c.logger.Debug("could not parse vault event", map[string]any{"err": err})
+			continue
+		}
+
+		s.notify(event)
+	}
+}
+
+// notify drops the document an event refers to from the cache, and signals its watches.
+func (s *eventSubscriber) notify(event vaultEvent) {
+	// Only the secret/ mount is read from, so events from other mounts are of no interest.
+	mount := event.Data.PluginInfo.MountPath
+	path := event.Data.Event.Metadata.Path
+	if (mount != "" && mount != "secret/") || !strings.HasPrefix(path, "secret/") {
+		return
+	}
+	path = strings.TrimPrefix(path, "secret/")
+
+	s.c.cache.Delete(path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.listeners[path] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
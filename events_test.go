@@ -0,0 +1,75 @@
+package confy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestEventNotifications(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"test/events": {"flag": "off"},
+	})
+
+	events := make(chan map[string]any)
+	subscribed := make(chan string, 2)
+	fake.handle("/v1/sys/events/subscribe/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "fake-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		subscribed <- r.URL.Path
+		for event := range events {
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		}
+	}))
+
+	// A long TTL makes sure the change can only be caught through the event.
+	config := New(fake.client(t), time.Hour, false, WithEventNotifications("kv-v1/data-write"))
+	defer config.Close()
+
+	changed := make(chan string, 1)
+	cancel := config.Watch("test/events#flag", func(oldVal, newVal Value) bool {
+		return oldVal.String() != newVal.String()
+	}, func(v Value) {
+		changed <- v.String()
+	})
+	defer cancel()
+
+	select {
+	case path := <-subscribed:
+		if path != "/v1/sys/events/subscribe/kv-v1/data-write" {
+			t.Fatalf("subscribed to the wrong endpoint: %s", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the event subscription")
+	}
+
+	// Give the watch a moment to read the initial value.
+	time.Sleep(100 * time.Millisecond)
+	fake.put("test/events", map[string]any{"flag": "on"})
+	events <- map[string]any{"data": map[string]any{
+		"event_type":  "kv-v1/data-write",
+		"event":       map[string]any{"metadata": map[string]any{"path": "secret/test/events"}},
+		"plugin_info": map[string]any{"mount_path": "secret/"},
+	}}
+
+	select {
+	case v := <-changed:
+		if v != "on" {
+			t.Fatalf("expected 'on'; got '%s'", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the watch to catch the event")
+	}
+	close(events)
+}
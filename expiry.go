@@ -0,0 +1,256 @@
+package confy
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// Sources an expiry date can be detected from.
+const (
+	ExpirySourceCertificate  = "x509"
+	ExpirySourceExpiresAt    = "expires_at"
+	ExpirySourceLease        = "lease"
+	ExpirySourceDeletionTime = "deletion_time"
+)
+
+// expiresAtField is the conventional field name used to record when a secret expires.
+// It may hold an RFC 3339 timestamp or a unix timestamp in seconds.
+const expiresAtField = "expires_at"
+
+// DefaultExpiryThresholds are the thresholds used by WithExpiryAlerts when none are given.
+var DefaultExpiryThresholds = []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour}
+
+// expiryCheckInterval is how often expiries are checked against the alert thresholds,
+// in between document loads.
+var expiryCheckInterval = time.Minute
+
+// Expiry is the expiry date of a secret, detected when its document was loaded. Field
+// is empty when the expiry applies to the whole document (leases and KV v2 deletion times).
+type Expiry struct {
+	Path      string    `json:"path"`
+	Field     string    `json:"field,omitempty"`
+	Source    string    `json:"source"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ExpiryAlert is raised once for every threshold an expiry date gets closer than.
+type ExpiryAlert struct {
+	Expiry
+	// Threshold is the threshold that was crossed.
+	Threshold time.Duration
+	// Remaining is the time left until the secret expires. It is negative for
+	// secrets that already expired.
+	Remaining time.Duration
+}
+
+// ExpiryReporter is implemented by the clients returned by New. Expiries lists the
+// expiry dates detected in the documents loaded so far, soonest first.
+type ExpiryReporter interface {
+	Expiries() []Expiry
+}
+
+// WithExpiryAlerts logs a warning, and calls callback if it is not nil, when a secret
+// gets closer to its expiry date than each of the given thresholds (DefaultExpiryThresholds
+// if none are given). Expiry dates are detected from:
+//   - the NotAfter date of PEM encoded certificates stored in a field,
+//   - an "expires_at" field, holding an RFC 3339 or unix timestamp,
+//   - the lease duration of dynamic secrets, and
+//   - the deletion_time of KV v2 metadata.
+//
+// Expiry dates are tracked regardless of this option, and exported as the
+// confy_secret_expiry_timestamp_seconds metric when WithMetrics is used.
+func WithExpiryAlerts(callback func(ExpiryAlert), thresholds ...time.Duration) Option {
+	return func(c *confyImpl) {
+		if len(thresholds) == 0 {
+			thresholds = DefaultExpiryThresholds
+		}
+		c.expiries.thresholds = append([]time.Duration(nil), thresholds...)
+		sort.Slice(c.expiries.thresholds, func(i, j int) bool { return c.expiries.thresholds[i] > c.expiries.thresholds[j] })
+		c.expiries.callback = callback
+	}
+}
+
+type expiryKey struct {
+	path   string
+	field  string
+	source string
+}
+
+type trackedExpiry struct {
+	Expiry
+	fired map[time.Duration]bool
+}
+
+// expiries tracks the expiry dates of loaded documents.
+type expiries struct {
+	thresholds []time.Duration
+	callback   func(ExpiryAlert)
+
+	mu      sync.Mutex
+	tracked map[expiryKey]*trackedExpiry
+}
+
+// detectExpiries finds every expiry date in a document read from Vault.
+func detectExpiries(path string, data map[string]any, secret *vaultapi.Secret) []Expiry {
+	found := []Expiry{}
+	for field, val := range data {
+		s, ok := val.(string)
+		if !ok || !strings.Contains(s, "-----BEGIN CERTIFICATE-----") {
+			continue
+		}
+
+		certs, err := Certificates(&value{val: s, set: true})
+		if err != nil || len(certs) == 0 {
+			continue
+		}
+		notAfter := certs[0].NotAfter
+		for _, cert := range certs[1:] {
+			if cert.NotAfter.Before(notAfter) {
+				notAfter = cert.NotAfter
+			}
+		}
+		found = append(found, Expiry{Path: path, Field: field, Source: ExpirySourceCertificate, ExpiresAt: notAfter})
+	}
+
+	if t, ok := parseTimestamp(data[expiresAtField]); ok {
+		found = append(found, Expiry{Path: path, Field: expiresAtField, Source: ExpirySourceExpiresAt, ExpiresAt: t})
+	}
+
+	if meta, ok := data["metadata"].(map[string]any); ok {
+		if t, ok := parseTimestamp(meta["deletion_time"]); ok {
+			found = append(found, Expiry{Path: path, Source: ExpirySourceDeletionTime, ExpiresAt: t})
+		}
+	}
+
+	// Only dynamic secrets have a lease; KV only returns a refresh interval hint.
+	if secret != nil && secret.LeaseID != "" && secret.LeaseDuration > 0 {
+		expiresAt := time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+		found = append(found, Expiry{Path: path, Source: ExpirySourceLease, ExpiresAt: expiresAt})
+	}
+
+	return found
+}
+
+func parseTimestamp(v any) (time.Time, bool) {
+	switch t := v.(type) {
+	case string:
+		if t == "" {
+			return time.Time{}, false
+		}
+		parsed, err := time.Parse(time.RFC3339, t)
+		return parsed, err == nil
+	case json.Number:
+		secs, err := t.Int64()
+		return time.Unix(secs, 0), err == nil
+	}
+
+	return time.Time{}, false
+}
+
+// observeExpiries replaces the expiries tracked for the document at path, and checks
+// them against the alert thresholds. Alerts are raised from a separate goroutine, since
+// this runs while the document is being loaded and callbacks may read from the client.
+func (c *confyImpl) observeExpiries(path string, data map[string]any, secret *vaultapi.Secret) {
+	found := detectExpiries(path, data, secret)
+
+	e := &c.expiries
+	e.mu.Lock()
+	current := map[expiryKey]bool{}
+	for _, exp := range found {
+		key := expiryKey{path: path, field: exp.Field, source: exp.Source}
+		current[key] = true
+		tracked, ok := e.tracked[key]
+		// Leases are renewed on every read, so only a different date for anything else
+		// means the secret was rotated.
+		if ok && (tracked.ExpiresAt.Equal(exp.ExpiresAt) || exp.Source == ExpirySourceLease) {
+			tracked.ExpiresAt = exp.ExpiresAt
+			continue
+		}
+		e.tracked[key] = &trackedExpiry{Expiry: exp, fired: map[time.Duration]bool{}}
+	}
+	for key, tracked := range e.tracked {
+		if key.path == path && !current[key] {
+			delete(e.tracked, key)
+			c.metrics.expiryRemoved(tracked.Expiry)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, exp := range found {
+		c.metrics.expiry(exp)
+	}
+	go c.checkExpiries()
+}
+
+// checkExpiries raises an alert for every threshold crossed since the last check.
+func (c *confyImpl) checkExpiries() {
+	e := &c.expiries
+	if len(e.thresholds) == 0 {
+		return
+	}
+
+	alerts := []ExpiryAlert{}
+	now := time.Now()
+	e.mu.Lock()
+	for _, tracked := range e.tracked {
+		remaining := tracked.ExpiresAt.Sub(now)
+		// Only alert once for the closest threshold crossed, and consider all the
+		// larger ones as crossed too.
+		crossed := time.Duration(-1)
+		for _, threshold := range e.thresholds {
+			if remaining <= threshold && !tracked.fired[threshold] {
+				tracked.fired[threshold] = true
+				crossed = threshold
+			}
+		}
+		if crossed >= 0 {
+			alerts = append(alerts, ExpiryAlert{Expiry: tracked.Expiry, Threshold: crossed, Remaining: remaining})
+		}
+	}
+	e.mu.Unlock()
+
+	for _, alert := range alerts {
+		c.logger.Warn("secret is about to expire", map[string]any{
+			"path":       alert.Path,
+			"field":      alert.Field,
+			"source":     alert.Source,
+			"expires_at": alert.ExpiresAt,
+			"remaining":  alert.Remaining.String(),
+		})
+		if e.callback != nil {
+			e.callback(alert)
+		}
+	}
+}
+
+// watchExpiries checks expiries against the alert thresholds periodically, until
+// the client is closed.
+func (c *confyImpl) watchExpiries() {
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.checkExpiries()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *confyImpl) Expiries() []Expiry {
+	c.expiries.mu.Lock()
+	defer c.expiries.mu.Unlock()
+	list := make([]Expiry, 0, len(c.expiries.tracked))
+	for _, tracked := range c.expiries.tracked {
+		list = append(list, tracked.Expiry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ExpiresAt.Before(list[j].ExpiresAt) })
+
+	return list
+}
@@ -0,0 +1,89 @@
+package confy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestExpiryTracking(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %s", err)
+	}
+	notAfter := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "confy"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create certificate: %s", err)
+	}
+
+	expiresAt := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+	fake := newFakeVault(t, map[string]map[string]any{
+		"test/tls": {"cert": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))},
+		"test/api": {"key": "abc", "expires_at": expiresAt.Format(time.RFC3339)},
+	})
+
+	alerts := make(chan ExpiryAlert, 10)
+	reg := prometheus.NewRegistry()
+	config := New(fake.client(t), time.Minute, false,
+		WithMetrics(reg),
+		WithExpiryAlerts(func(a ExpiryAlert) { alerts <- a }, 24*time.Hour, 3*time.Hour, time.Hour),
+	)
+	defer config.Close()
+	ctx := context.Background()
+
+	for _, path := range []string{"test/tls", "test/api"} {
+		if _, err := config.Get(ctx, path); err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+	}
+
+	list := config.(ExpiryReporter).Expiries()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 expiries; got %+v", list)
+	}
+	if list[0].Source != ExpirySourceCertificate || !list[0].ExpiresAt.Equal(notAfter) {
+		t.Fatalf("expected the certificate to expire first; got %+v", list[0])
+	}
+	if list[1].Source != ExpirySourceExpiresAt || !list[1].ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("expected the expires_at field to be tracked; got %+v", list[1])
+	}
+
+	gauge := testutil.ToFloat64(newMetrics(reg).expiries.WithLabelValues("test/tls", "cert", ExpirySourceCertificate))
+	if int64(gauge) != notAfter.Unix() {
+		t.Fatalf("expected the expiry gauge to be set")
+	}
+
+	select {
+	case alert := <-alerts:
+		if alert.Path != "test/tls" || alert.Threshold != 3*time.Hour {
+			t.Fatalf("expected a single alert for the closest threshold crossed; got %+v", alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the expiry alert")
+	}
+
+	// Alerts only fire once per threshold.
+	config.(*confyImpl).checkExpiries()
+	select {
+	case alert := <-alerts:
+		t.Fatalf("did not expect another alert; got %+v", alert)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,126 @@
+package confy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bank-vaults/vault-sdk/vault"
+)
+
+// fakeVault is a minimal stand-in for a Vault server with a KV v1 engine mounted
+// at secret/. It lets tests run without the docker based Vault used by `make test`.
+type fakeVault struct {
+	*httptest.Server
+	mu       sync.Mutex
+	docs     map[string]map[string]any
+	reads    map[string]int
+	handlers map[string]http.Handler
+}
+
+func newFakeVault(t *testing.T, docs map[string]map[string]any) *fakeVault {
+	t.Helper()
+	f := &fakeVault{docs: map[string]map[string]any{}, reads: map[string]int{}, handlers: map[string]http.Handler{}}
+	for k, v := range docs {
+		f.docs[k] = v
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// client returns a vault client authenticated with a static token against the fake server.
+func (f *fakeVault) client(t *testing.T) *vault.Client {
+	t.Helper()
+	t.Setenv("VAULT_ADDR", f.URL)
+	client, err := vault.NewClientWithOptions(vault.ClientToken("fake-token"))
+	if err != nil {
+		t.Fatalf("could not create vault client: %s", err)
+	}
+	return client
+}
+
+// handle routes requests under the given URL path prefix to h, for endpoints
+// other than the KV engine.
+func (f *fakeVault) handle(prefix string, h http.Handler) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[prefix] = h
+}
+
+func (f *fakeVault) put(path string, data map[string]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.docs[path] = data
+}
+
+func (f *fakeVault) readCount(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reads[path]
+}
+
+func (f *fakeVault) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	for prefix, h := range f.handlers {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			f.mu.Unlock()
+			h.ServeHTTP(w, r)
+			return
+		}
+	}
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/secret/")
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("list") == "true", r.Method == "LIST":
+		prefix := strings.TrimSuffix(path, "/") + "/"
+		seen := map[string]bool{}
+		keys := []string{}
+		for k := range f.docs {
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			rest := strings.TrimPrefix(k, prefix)
+			if i := strings.Index(rest, "/"); i >= 0 {
+				rest = rest[:i+1]
+			}
+			if !seen[rest] {
+				seen[rest] = true
+				keys = append(keys, rest)
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		sort.Strings(keys)
+		writeJSON(w, map[string]any{"data": map[string]any{"keys": keys}})
+	case r.Method == http.MethodGet:
+		f.reads[path]++
+		doc, ok := f.docs[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]any{"errors": []string{}})
+			return
+		}
+		writeJSON(w, map[string]any{"data": doc, "lease_duration": 0})
+	case r.Method == http.MethodPut, r.Method == http.MethodPost:
+		var doc map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&doc)
+		f.docs[path] = doc
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,80 @@
+package confy
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNotInSnapshot is returned by the reads of a frozen client for documents that were not
+// loaded before it was frozen.
+var ErrNotInSnapshot = errors.New("not loaded before the client was frozen")
+
+// Freezer is implemented by the clients returned by New, for services that must not see
+// their configuration change while they run, such as batch jobs that need to be
+// reproducible.
+type Freezer interface {
+	// Freeze takes a snapshot of every document loaded so far, and serves every later
+	// read from it until Unfreeze is called. Documents are no longer refreshed from Vault,
+	// and watches are suspended. Documents that were not found are still reported as not
+	// found, and reading any other document that is not in the snapshot returns an error
+	// wrapping ErrNotInSnapshot. Environment overrides still apply.
+	Freeze()
+	// Unfreeze goes back to reading from the cache and Vault, and resumes watches. Watches
+	// fire on their next check for values that changed while the client was frozen.
+	Unfreeze()
+	// Frozen reports whether the client is frozen.
+	Frozen() bool
+}
+
+// freezer holds the snapshot of a frozen client. The snapshot is nil when it is not frozen.
+type freezer struct {
+	mu       sync.RWMutex
+	snapshot map[string]loadedDocument
+	// missing holds the documents that were not found when the client was frozen, so that
+	// they are still reported as not found.
+	missing map[string]bool
+}
+
+func (c *confyImpl) Freeze() {
+	snapshot, missing := c.docs.snapshot()
+
+	c.frozen.mu.Lock()
+	c.frozen.snapshot, c.frozen.missing = snapshot, missing
+	c.frozen.mu.Unlock()
+	c.logger.Info("confy client frozen", map[string]any{"documents": len(snapshot)})
+}
+
+func (c *confyImpl) Unfreeze() {
+	c.frozen.mu.Lock()
+	c.frozen.snapshot, c.frozen.missing = nil, nil
+	c.frozen.mu.Unlock()
+	c.logger.Info("confy client unfrozen", nil)
+}
+
+func (c *confyImpl) Frozen() bool {
+	c.frozen.mu.RLock()
+	defer c.frozen.mu.RUnlock()
+	return c.frozen.snapshot != nil
+}
+
+// frozenDocument returns the snapshot of the document cached under key. The second return
+// value is false if the client is not frozen.
+func (c *confyImpl) frozenDocument(key string) (loadedDocument, bool, error) {
+	c.frozen.mu.RLock()
+	defer c.frozen.mu.RUnlock()
+	if c.frozen.snapshot == nil {
+		return loadedDocument{}, false, nil
+	}
+
+	doc, ok := c.frozen.snapshot[key]
+	if !ok && c.frozen.missing[key] {
+		return loadedDocument{}, true, fmt.Errorf("secret '%s' was %w when the client was frozen", key, ErrNotFound)
+	}
+	if !ok {
+		c.logger.Warn("confy client is frozen, and the document was not loaded before", map[string]any{"path": key})
+		return loadedDocument{}, true, fmt.Errorf("secret '%s' was %w", key, ErrNotInSnapshot)
+	}
+
+	return doc, true, nil
+}
@@ -0,0 +1,95 @@
+package confy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFreeze(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"app":   {"user": "a"},
+		"other": {"user": "b"},
+	})
+	c := new(fake.client(t), 100*time.Millisecond, false).(*confyImpl)
+	defer c.Close()
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "app#user"); err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	changed := make(chan string, 2)
+	cancel := c.Watch("app#user", func(oldVal, newVal Value) bool {
+		return oldVal.String() != newVal.String()
+	}, func(v Value) {
+		changed <- v.String()
+	})
+	defer cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	c.Freeze()
+	if !c.Frozen() {
+		t.Fatal("expected the client to be frozen")
+	}
+	fake.put("app", map[string]any{"user": "changed"})
+	reads := fake.readCount("app")
+	time.Sleep(200 * time.Millisecond)
+
+	if v, err := c.Get(ctx, "app#user"); err != nil || v.String() != "a" {
+		t.Fatalf("expected the frozen value; got %v, %v", v, err)
+	}
+	if _, err := c.Get(ctx, "other#user"); !errors.Is(err, ErrNotInSnapshot) {
+		t.Fatalf("expected a snapshot error; got %v", err)
+	}
+	select {
+	case v := <-changed:
+		t.Fatalf("expected the watch to be suspended; got %s", v)
+	case <-time.After(1500 * time.Millisecond):
+	}
+	if n := fake.readCount("app"); n != reads {
+		t.Fatalf("expected no reads from Vault while frozen; got %d", n-reads)
+	}
+
+	c.Unfreeze()
+	if v, err := c.Get(ctx, "app#user"); err != nil || v.String() != "changed" {
+		t.Fatalf("expected the new value; got %v, %v", v, err)
+	}
+	select {
+	case v := <-changed:
+		if v != "changed" {
+			t.Fatalf("expected 'changed'; got %s", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the watch to resume")
+	}
+}
+
+func TestFreezeAlternatives(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{"legacy/app": {"user": "old"}})
+	c := new(fake.client(t), time.Minute, false).(*confyImpl)
+	defer c.Close()
+	ctx := context.Background()
+
+	path := FirstOf("newsvc/app#user", "legacy/app#user")
+	if v, err := c.Get(ctx, path); err != nil || v.String() != "old" {
+		t.Fatalf("expected the legacy value; got %v, %v", v, err)
+	}
+
+	c.Freeze()
+	defer c.Unfreeze()
+	if v, err := c.Get(ctx, path); err != nil || v.String() != "old" {
+		t.Fatalf("expected the legacy value while frozen; got %v, %v", v, err)
+	}
+	if _, err := c.Get(ctx, "newsvc/app#user"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the missing document to be reported as not found; got %v", err)
+	}
+	if _, ok, err := Optional[string](ctx, c, "newsvc/app#user"); ok || err != nil {
+		t.Fatalf("expected a missing optional value; got %t, %v", ok, err)
+	}
+
+	// Paths that were never read are skipped too.
+	if v, err := c.Get(ctx, FirstOf("other/app#user", "legacy/app#user")); err != nil || v.String() != "old" {
+		t.Fatalf("expected the legacy value; got %v, %v", v, err)
+	}
+}
@@ -0,0 +1,241 @@
+package confy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+const (
+	// DefaultHedgePercentile is the percentile of recent read latencies after which a
+	// hedged read is sent, unless HedgePolicy.Percentile says otherwise.
+	DefaultHedgePercentile = 0.95
+	// DefaultHedgeBudget is the share of reads that may be hedged, unless
+	// HedgePolicy.Budget says otherwise.
+	DefaultHedgeBudget = 0.05
+	// DefaultHedgeMinDelay is the shortest delay before a hedged read, unless
+	// HedgePolicy.MinDelay says otherwise.
+	DefaultHedgeMinDelay = 10 * time.Millisecond
+
+	// hedgeSamples is how many recent read latencies the delay is computed from, and
+	// hedgeMinSamples how many are needed before reads are hedged at all.
+	hedgeSamples    = 256
+	hedgeMinSamples = 20
+	// hedgeBurst is how many hedged reads may be sent in a row once the budget has built up.
+	hedgeBurst = 10
+)
+
+// HedgePolicy configures hedged reads (see WithHedging).
+type HedgePolicy struct {
+	// Percentile, between 0 and 1, of the latencies of recent reads after which a read
+	// is hedged. It is DefaultHedgePercentile if 0.
+	Percentile float64
+	// MinDelay is the shortest delay before a read is hedged. It is DefaultHedgeMinDelay if 0.
+	MinDelay time.Duration
+	// Budget is the share of reads, between 0 and 1, that may be hedged. Reads past
+	// the budget are not hedged. It is DefaultHedgeBudget if 0.
+	Budget float64
+	// Replicas are the addresses of other Vault servers, such as performance standbys,
+	// that hedged reads are sent to in turn. Hedged reads are sent to the same server
+	// as the original read if there are none.
+	Replicas []string
+}
+
+// WithHedging hedges the reads of KV documents from Vault: a read that has not returned
+// after the given percentile of recent read latencies is sent again, to the next replica
+// if any, and the first successful response is used. The extra load is bounded by the
+// policy budget. With WithMetrics, hedged reads are counted by outcome in the
+// confy_vault_hedged_reads_total metric, and the current delay is exported as
+// confy_vault_hedge_delay_seconds.
+func WithHedging(policy HedgePolicy) Option {
+	return func(c *confyImpl) {
+		if policy.Percentile <= 0 || policy.Percentile > 1 {
+			policy.Percentile = DefaultHedgePercentile
+		}
+		if policy.MinDelay <= 0 {
+			policy.MinDelay = DefaultHedgeMinDelay
+		}
+		if policy.Budget <= 0 {
+			policy.Budget = DefaultHedgeBudget
+		}
+		c.hedger = &hedger{policy: policy}
+	}
+}
+
+// hedger keeps track of the latency of recent reads, and of the budget left for hedging them.
+type hedger struct {
+	policy   HedgePolicy
+	replicas []*vaultapi.Client
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+	tokens    float64
+	replica   int
+}
+
+// connect creates the clients used to send hedged reads to the replicas.
+func (h *hedger) connect(client *vaultapi.Client) error {
+	for _, addr := range h.policy.Replicas {
+		replica, err := client.CloneWithHeaders()
+		if err != nil {
+			return err
+		}
+		if err := replica.SetAddress(addr); err != nil {
+			return fmt.Errorf("could not use Vault replica '%s': %w", addr, err)
+		}
+		h.replicas = append(h.replicas, replica)
+	}
+
+	return nil
+}
+
+// delay returns how long to wait before hedging a read, or false if there are not
+// enough recent reads to tell yet.
+func (h *hedger) delay() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeMinSamples {
+		return 0, false
+	}
+
+	sorted := append([]time.Duration(nil), h.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	d := sorted[int(math.Ceil(h.policy.Percentile*float64(len(sorted))))-1]
+	if d < h.policy.MinDelay {
+		d = h.policy.MinDelay
+	}
+
+	return d, true
+}
+
+// observe records the latency of a read.
+func (h *hedger) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeSamples {
+		h.latencies = append(h.latencies, latency)
+	} else {
+		h.latencies[h.next] = latency
+		h.next = (h.next + 1) % hedgeSamples
+	}
+}
+
+// earn adds the share of a read to the hedge budget.
+func (h *hedger) earn() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tokens = math.Min(h.tokens+h.policy.Budget, hedgeBurst)
+}
+
+// spend takes a hedged read out of the budget. It returns false if the budget is spent.
+func (h *hedger) spend() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+// target returns the client to send the next hedged read with.
+func (h *hedger) target(primary *vaultapi.Client) *vaultapi.Client {
+	if len(h.replicas) == 0 {
+		return primary
+	}
+
+	h.mu.Lock()
+	replica := h.replicas[h.replica]
+	h.replica = (h.replica + 1) % len(h.replicas)
+	h.mu.Unlock()
+	// The token changes every time the client logs in again.
+	replica.SetToken(primary.Token())
+
+	return replica
+}
+
+// read runs get with primary, and again with a replica if it takes longer than the
+// hedge delay and the budget allows it. It returns the first successful response, or
+// the error of the original read if both fail.
+func (h *hedger) read(ctx context.Context, m *metrics, primary *vaultapi.Client, get func(context.Context, *vaultapi.Client) (*vaultapi.KVSecret, error)) (*vaultapi.KVSecret, error) {
+	h.earn()
+	delay, ok := h.delay()
+	if ok {
+		m.hedgeDelay(delay)
+	}
+
+	type result struct {
+		secret *vaultapi.KVSecret
+		err    error
+		hedged bool
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan result, 2)
+	start := time.Now()
+	send := func(client *vaultapi.Client, hedged bool) {
+		secret, err := get(ctx, client)
+		results <- result{secret: secret, err: err, hedged: hedged}
+	}
+	// Not found is an answer as good as any other.
+	done := func(r result) bool {
+		return r.err == nil || errors.Is(r.err, vaultapi.ErrSecretNotFound)
+	}
+
+	go send(primary, false)
+	if !ok {
+		r := <-results
+		if done(r) {
+			h.observe(time.Since(start))
+		}
+		return r.secret, r.err
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		if done(r) {
+			h.observe(time.Since(start))
+		}
+		return r.secret, r.err
+	case <-timer.C:
+	}
+
+	if !h.spend() {
+		m.hedgedRead("throttled")
+		r := <-results
+		if done(r) {
+			h.observe(time.Since(start))
+		}
+		return r.secret, r.err
+	}
+	go send(h.target(primary), true)
+
+	var failed result
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if done(r) {
+			h.observe(time.Since(start))
+			if r.hedged {
+				m.hedgedRead("won")
+			} else {
+				m.hedgedRead("lost")
+			}
+			return r.secret, r.err
+		}
+		if !r.hedged || failed.err == nil {
+			failed = r
+		}
+	}
+	m.hedgedRead("failed")
+
+	return failed.secret, failed.err
+}
@@ -0,0 +1,73 @@
+package confy
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHedging(t *testing.T) {
+	var slow atomic.Bool
+	release := make(chan struct{})
+	primary := newFakeVault(t, nil)
+	primary.handle("/v1/secret/app", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		writeJSON(w, map[string]any{"data": map[string]any{"user": "primary"}})
+	}))
+	replica := newFakeVault(t, map[string]map[string]any{"app": {"user": "replica"}})
+
+	reg := prometheus.NewRegistry()
+	c := new(primary.client(t), time.Minute, false, WithMetrics(reg), WithHedging(HedgePolicy{
+		Percentile: 0.9,
+		MinDelay:   20 * time.Millisecond,
+		Budget:     0.1,
+		Replicas:   []string{replica.URL},
+	})).(*confyImpl)
+	defer c.Close()
+	ctx := context.Background()
+
+	// Reads are not hedged until there are enough of them to tell what is slow.
+	for i := 0; i < hedgeMinSamples; i++ {
+		doc, err := c.readKV(ctx, "app")
+		if err != nil || doc.Data["user"] != "primary" {
+			t.Fatalf("unexpected document: %+v, %v", doc, err)
+		}
+	}
+
+	slow.Store(true)
+	doc, err := c.readKV(ctx, "app")
+	if err != nil || doc.Data["user"] != "replica" {
+		t.Fatalf("expected the hedged read to the replica to win; got %+v, %v", doc, err)
+	}
+	if n := testutil.ToFloat64(c.metrics.hedgedReads.WithLabelValues("won")); n != 1 {
+		t.Fatalf("expected a hedged read to be counted; got %v", n)
+	}
+	if d := testutil.ToFloat64(c.metrics.hedgeDelays); d < 0.02 {
+		t.Fatalf("expected the hedge delay to be at least the minimum; got %v", d)
+	}
+
+	// Once the budget is spent, slow reads are not hedged.
+	c.hedger.tokens = 0
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+	}()
+	doc, err = c.readKV(ctx, "app")
+	if err != nil || doc.Data["user"] != "primary" {
+		t.Fatalf("expected the read not to be hedged; got %+v, %v", doc, err)
+	}
+	if n := testutil.ToFloat64(c.metrics.hedgedReads.WithLabelValues("throttled")); n != 1 {
+		t.Fatalf("expected a throttled hedge to be counted; got %v", n)
+	}
+}
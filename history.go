@@ -0,0 +1,216 @@
+package confy
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redactedValue replaces the values of secret fields in the history. It gives away
+// nothing about the value, not even its length, since every rotation is recorded.
+const redactedValue = "[redacted]"
+
+// DefaultHistorySize is how many versions of each document are remembered, unless
+// WithHistorySize says otherwise.
+const DefaultHistorySize = 10
+
+// Kinds of FieldChange.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// DocumentVersion is a version of a document seen by the client.
+type DocumentVersion struct {
+	// Hash, Version and Generation are those of the document at the time (see DocumentInfo).
+	Hash       string `json:"hash"`
+	Version    int64  `json:"version,omitempty"`
+	Generation uint64 `json:"generation"`
+	// ObservedAt is when the client first loaded this version.
+	ObservedAt time.Time `json:"observed_at"`
+	// Changes lists the fields that differ from the previous version, sorted by field.
+	// Every field of the first version seen is reported as added.
+	Changes []FieldChange `json:"changes"`
+}
+
+// FieldChange describes how a field changed between two versions of a document. Fields
+// of nested documents are named with dots. Values are replaced with "[redacted]", unless
+// the field is marked with WithNonSecretFields (and not with WithSecretFields).
+type FieldChange struct {
+	Field string `json:"field"`
+	// Kind is one of ChangeAdded, ChangeRemoved or ChangeChanged.
+	Kind string `json:"kind"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// HistoryReporter is implemented by the clients returned by New. It answers questions
+// like "when did this replica see the timeout change?", even on KV v1 where Vault keeps
+// no history.
+type HistoryReporter interface {
+	// History returns the versions of the document at path seen by the client, oldest
+	// first. Only the last versions are kept (see WithHistorySize).
+	History(path string) []DocumentVersion
+	// Histories returns the versions of every document seen by the client, by path.
+	Histories() map[string][]DocumentVersion
+}
+
+// WithHistorySize sets how many versions of each document are remembered (see
+// HistoryReporter). It is DefaultHistorySize by default, and 0 disables the history.
+func WithHistorySize(n int) Option {
+	return func(c *confyImpl) {
+		if n >= 0 {
+			c.history.size = n
+		}
+	}
+}
+
+// history keeps the last versions of every document, in a ring buffer per document.
+type history struct {
+	size int
+
+	mu       sync.Mutex
+	versions map[string]*versionRing
+}
+
+type versionRing struct {
+	versions []DocumentVersion
+	// next is where the next version goes once the ring is full.
+	next int
+}
+
+func (r *versionRing) add(v DocumentVersion, size int) {
+	if len(r.versions) < size {
+		r.versions = append(r.versions, v)
+		return
+	}
+	r.versions[r.next] = v
+	r.next = (r.next + 1) % size
+}
+
+// list returns the versions in the ring, oldest first.
+func (r *versionRing) list() []DocumentVersion {
+	return append(append([]DocumentVersion(nil), r.versions[r.next:]...), r.versions[:r.next]...)
+}
+
+// recordHistory records a new version of the document at path, whose previous content was old.
+func (c *confyImpl) recordHistory(path string, info DocumentInfo, old, data map[string]any) {
+	if c.history.size == 0 {
+		return
+	}
+
+	v := DocumentVersion{
+		Hash:       info.Hash,
+		Version:    info.Version,
+		Generation: info.Generation,
+		ObservedAt: info.ChangedAt,
+		Changes:    c.diff(path, old, data),
+	}
+
+	c.history.mu.Lock()
+	defer c.history.mu.Unlock()
+	if c.history.versions == nil {
+		c.history.versions = map[string]*versionRing{}
+	}
+	ring, ok := c.history.versions[path]
+	if !ok {
+		ring = &versionRing{}
+		c.history.versions[path] = ring
+	}
+	ring.add(v, c.history.size)
+}
+
+func (c *confyImpl) History(path string) []DocumentVersion {
+	path = strings.TrimPrefix(path, "secret/")
+	c.history.mu.Lock()
+	defer c.history.mu.Unlock()
+	ring, ok := c.history.versions[path]
+	if !ok {
+		return []DocumentVersion{}
+	}
+
+	return ring.list()
+}
+
+func (c *confyImpl) Histories() map[string][]DocumentVersion {
+	c.history.mu.Lock()
+	defer c.history.mu.Unlock()
+	histories := make(map[string][]DocumentVersion, len(c.history.versions))
+	for path, ring := range c.history.versions {
+		histories[path] = ring.list()
+	}
+
+	return histories
+}
+
+// diff returns the redacted changes between two versions of the document at path.
+func (c *confyImpl) diff(path string, old, data map[string]any) []FieldChange {
+	before, after := map[string]any{}, map[string]any{}
+	flatten(old, "", before)
+	flatten(data, "", after)
+
+	changes := []FieldChange{}
+	for field, v := range after {
+		prev, ok := before[field]
+		switch {
+		case !ok:
+			changes = append(changes, FieldChange{Field: field, Kind: ChangeAdded, New: c.historyValue(path, field, v)})
+		case !reflect.DeepEqual(prev, v):
+			changes = append(changes, FieldChange{
+				Field: field,
+				Kind:  ChangeChanged,
+				Old:   c.historyValue(path, field, prev),
+				New:   c.historyValue(path, field, v),
+			})
+		}
+	}
+	for field, v := range before {
+		if _, ok := after[field]; !ok {
+			changes = append(changes, FieldChange{Field: field, Kind: ChangeRemoved, Old: c.historyValue(path, field, v)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	return changes
+}
+
+// flatten adds the fields of data to fields, naming the fields of nested documents with dots.
+func flatten(data map[string]any, prefix string, fields map[string]any) {
+	for k, v := range data {
+		if nested, ok := v.(map[string]any); ok {
+			flatten(nested, prefix+k+".", fields)
+			continue
+		}
+		fields[prefix+k] = v
+	}
+}
+
+// historyValue formats the value of a field for the history, fully redacted unless the
+// field may be published.
+func (c *confyImpl) historyValue(path, field string, v any) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case nil:
+		s = "null"
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			s = fmt.Sprint(v)
+		} else {
+			s = string(b)
+		}
+	}
+
+	getPath := strings.TrimPrefix(path, "/") + "#" + field
+	if c.nonSecrets.match(getPath) && !c.secrets.match(getPath) {
+		return s
+	}
+	return redactedValue
+}
@@ -0,0 +1,88 @@
+package confy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"app": {"timeout": "30s", "password": "hunter2", "pool": map[string]any{"size": 5}},
+	})
+	c := new(fake.client(t), time.Minute, false, WithHistorySize(2), WithNonSecretFields("app#timeout", "app#pool.*")).(*confyImpl)
+	defer c.Close()
+	ctx := context.Background()
+
+	load := func() {
+		t.Helper()
+		c.cache.Delete("app")
+		if _, err := c.Get(ctx, "app"); err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+	}
+	load()
+	load() // Same content, so no new version.
+	fake.put("app", map[string]any{"timeout": "60s", "password": "correct horse battery staple", "pool": map[string]any{"size": 5}})
+	load()
+
+	versions := c.History("secret/app")
+	if len(versions) != 2 || versions[0].Generation != 1 || versions[1].Generation != 2 {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	if want := []FieldChange{
+		{Field: "password", Kind: ChangeAdded, New: "[redacted]"},
+		{Field: "pool.size", Kind: ChangeAdded, New: "5"},
+		{Field: "timeout", Kind: ChangeAdded, New: "30s"},
+	}; !reflect.DeepEqual(versions[0].Changes, want) {
+		t.Fatalf("unexpected changes: %+v", versions[0].Changes)
+	}
+	if want := []FieldChange{
+		{Field: "password", Kind: ChangeChanged, Old: "[redacted]", New: "[redacted]"},
+		{Field: "timeout", Kind: ChangeChanged, Old: "30s", New: "60s"},
+	}; !reflect.DeepEqual(versions[1].Changes, want) {
+		t.Fatalf("unexpected changes: %+v", versions[1].Changes)
+	}
+
+	// Only the last versions are kept.
+	fake.put("app", map[string]any{"timeout": "60s"})
+	load()
+	versions = c.History("app")
+	if len(versions) != 2 || versions[0].Generation != 2 || versions[1].Generation != 3 {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	if want := []FieldChange{
+		{Field: "password", Kind: ChangeRemoved, Old: "[redacted]"},
+		{Field: "pool.size", Kind: ChangeRemoved, Old: "5"},
+	}; !reflect.DeepEqual(versions[1].Changes, want) {
+		t.Fatalf("unexpected changes: %+v", versions[1].Changes)
+	}
+
+	rec := httptest.NewRecorder()
+	NewAdminHandler(c).ServeHTTP(rec, httptest.NewRequest("GET", "/history", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected the history not to be served by default; got %d", rec.Code)
+	}
+
+	admin := NewAdminHandler(c, WithAdminHistory(c))
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/history?path=app", nil))
+	var served []DocumentVersion
+	if err := json.NewDecoder(rec.Body).Decode(&served); err != nil {
+		t.Fatalf("could not decode response: %s", err)
+	}
+	if len(served) != 2 || served[1].Hash != versions[1].Hash {
+		t.Fatalf("unexpected history: %+v", served)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/history", nil))
+	var all map[string][]DocumentVersion
+	if err := json.NewDecoder(rec.Body).Decode(&all); err != nil || len(all["app"]) != 2 {
+		t.Fatalf("unexpected histories: %+v, %v", all, err)
+	}
+}
@@ -0,0 +1,165 @@
+package confy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	identityTokenMinBackoff = time.Second
+	identityTokenMaxBackoff = time.Minute
+)
+
+// IdentityTokenIssuer is implemented by the clients returned by New.
+type IdentityTokenIssuer interface {
+	// IdentityTokenSource returns a source of Vault identity tokens (signed OIDC JWTs) for
+	// role, issued by identity/oidc/token/<role> with the client's own Vault login. Tokens are
+	// cached and refreshed in the background once two thirds of their TTL have passed, so
+	// Token only waits on Vault for the first token, or if refreshing keeps failing. Sources
+	// are shared per role, and stop refreshing when the client is closed.
+	//
+	// The source plugs into HTTP clients with oauth2.NewClient(ctx, source), or an
+	// oauth2.Transport, which send the token as a bearer token.
+	IdentityTokenSource(role string) oauth2.TokenSource
+}
+
+// identityTokens holds the identity token sources handed out so far, by role.
+type identityTokens struct {
+	mu      sync.Mutex
+	sources map[string]*identityTokenSource
+}
+
+func (c *confyImpl) IdentityTokenSource(role string) oauth2.TokenSource {
+	c.identities.mu.Lock()
+	defer c.identities.mu.Unlock()
+	if c.identities.sources == nil {
+		c.identities.sources = map[string]*identityTokenSource{}
+	}
+	s, ok := c.identities.sources[role]
+	if !ok {
+		s = &identityTokenSource{c: c, role: role}
+		c.identities.sources[role] = s
+	}
+
+	return s
+}
+
+type identityTokenSource struct {
+	c    *confyImpl
+	role string
+
+	mu         sync.Mutex
+	token      *oauth2.Token
+	staleAt    time.Time
+	refreshing bool
+}
+
+func (s *identityTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != nil && time.Now().Before(s.staleAt) {
+		return s.token, nil
+	}
+
+	token, ttl, err := s.fetch(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	s.set(token, ttl)
+	if !s.refreshing {
+		s.refreshing = true
+		go s.refresh(ttl)
+	}
+
+	return token, nil
+}
+
+// set replaces the cached token. It is served until a sixth of its TTL is left, which
+// leaves the background refresh some room to retry before callers have to wait on Vault.
+func (s *identityTokenSource) set(token *oauth2.Token, ttl time.Duration) {
+	s.token = token
+	s.staleAt = token.Expiry.Add(-ttl / 6)
+}
+
+// refresh fetches a new token whenever two thirds of the current one's TTL have passed,
+// until the client is closed.
+func (s *identityTokenSource) refresh(ttl time.Duration) {
+	wait := ttl * 2 / 3
+	backoff := identityTokenMinBackoff
+	for {
+		select {
+		case <-s.c.done:
+			return
+		case <-time.After(wait):
+		}
+
+		token, newTTL, err := s.fetch(context.Background())
+		if err != nil {
+			s.c.logger.Warn("could not refresh vault identity token", map[string]any{
+				"role":     s.role,
+				"err":      err,
+				"retry_in": backoff.String(),
+			})
+			wait = backoff
+			if backoff *= 2; backoff > identityTokenMaxBackoff {
+				backoff = identityTokenMaxBackoff
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		s.set(token, newTTL)
+		s.mu.Unlock()
+		wait, backoff = newTTL*2/3, identityTokenMinBackoff
+	}
+}
+
+// fetch issues a new identity token. It returns the token and its TTL.
+func (s *identityTokenSource) fetch(ctx context.Context) (*oauth2.Token, time.Duration, error) {
+	path := "identity/oidc/token/" + s.role
+	if s.c.client == nil {
+		return nil, 0, errNoVaultClient
+	}
+	start := time.Now()
+	secret, err := s.c.client.RawClient().Logical().ReadWithContext(ctx, path)
+	s.c.metrics.request("read", path, start, err)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not get identity token for role '%s': %w", s.role, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, 0, fmt.Errorf("identity token role '%s' was %w in Vault", s.role, ErrNotFound)
+	}
+
+	jwt, _ := secret.Data["token"].(string)
+	if jwt == "" {
+		return nil, 0, fmt.Errorf("vault returned no identity token for role '%s'", s.role)
+	}
+	ttl, err := tokenTTL(secret.Data["ttl"])
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid ttl for identity token role '%s': %w", s.role, err)
+	}
+
+	return &oauth2.Token{AccessToken: jwt, TokenType: "Bearer", Expiry: time.Now().Add(ttl)}, ttl, nil
+}
+
+func tokenTTL(v any) (time.Duration, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, errors.New("missing ttl")
+	}
+	secs, err := n.Int64()
+	if err != nil {
+		return 0, err
+	}
+	if secs <= 0 {
+		return 0, fmt.Errorf("ttl must be positive, got %d", secs)
+	}
+
+	return time.Duration(secs) * time.Second, nil
+}
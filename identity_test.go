@@ -0,0 +1,82 @@
+package confy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestIdentityTokenSource(t *testing.T) {
+	fake := newFakeVault(t, nil)
+	var mu sync.Mutex
+	issued := 0
+	fake.handle("/v1/identity/oidc/token/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/identity/oidc/token/svc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		issued++
+		writeJSON(w, map[string]any{"data": map[string]any{
+			"client_id": "client",
+			"token":     fmt.Sprintf("jwt-%d", issued),
+			"ttl":       3,
+		}})
+	}))
+	issuedCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return issued
+	}
+
+	c := new(fake.client(t), time.Minute, false)
+	defer c.Close()
+	issuer := c.(IdentityTokenIssuer)
+	source := issuer.IdentityTokenSource("svc")
+	if issuer.IdentityTokenSource("svc") != source {
+		t.Fatalf("expected sources to be shared per role")
+	}
+
+	auth := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth <- r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	client := oauth2.NewClient(context.Background(), source)
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		resp.Body.Close()
+		if header := <-auth; header != "Bearer jwt-1" {
+			t.Fatalf("expected the cached token to be sent; got %q", header)
+		}
+	}
+	if issuedCount() != 1 {
+		t.Fatalf("expected a single token to be issued; got %d", issuedCount())
+	}
+
+	// The token is refreshed in the background after two thirds of its TTL.
+	deadline := time.Now().Add(5 * time.Second)
+	for issuedCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	token, err := source.Token()
+	if err != nil || token.AccessToken != "jwt-2" {
+		t.Fatalf("expected the refreshed token; got %v, %v", token, err)
+	}
+
+	if _, err := issuer.IdentityTokenSource("missing").Token(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a not found error; got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package confy
+
+import (
+	"context"
+)
+
+// Invoker performs a Get for path.
+type Invoker func(ctx context.Context, path string) (Value, error)
+
+// Interceptor intercepts every Get call (and therefore every GetOrDefault call, and every
+// read done by watches). It must call next to carry on with the lookup, and may inspect
+// or change the path, the context, the returned value and the error, or skip next
+// altogether. Paths reach interceptors without the secret/ prefix.
+//
+// Interceptors run in the order they were given to WithInterceptors, the first one being
+// the outermost. They all run before the built-in layers, which are, from the outside in:
+// the environment override (when envOverride is true), the cache, and Vault. So an
+// interceptor sees values overridden from the environment, and runs on cache hits too.
+type Interceptor func(ctx context.Context, path string, next Invoker) (Value, error)
+
+// WatchInterceptor intercepts the dispatch of a watch callback for path. It must call
+// next for the callback to run. Watch interceptors run in the order they were given to
+// WithWatchInterceptors, the first one being the outermost.
+type WatchInterceptor func(path string, v Value, next func(v Value))
+
+// WithInterceptors adds interceptors around Get. See Interceptor for their ordering.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(c *confyImpl) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// WithWatchInterceptors adds interceptors around the dispatch of watch callbacks.
+func WithWatchInterceptors(interceptors ...WatchInterceptor) Option {
+	return func(c *confyImpl) {
+		c.watchInterceptors = append(c.watchInterceptors, interceptors...)
+	}
+}
+
+// chainInterceptors returns an invoker that runs interceptors in order around final.
+func chainInterceptors(interceptors []Interceptor, final Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], final
+		final = func(ctx context.Context, path string) (Value, error) {
+			return interceptor(ctx, path, next)
+		}
+	}
+
+	return final
+}
+
+// envOverrideInterceptor serves values from the environment when they are allowed
+// to be overridden, without going any further.
+func (c *confyImpl) envOverrideInterceptor(ctx context.Context, path string, next Invoker) (Value, error) {
+	if envValue, ok := c.lookupOverride(path); ok {
+		return &value{val: envValue, set: true, provenance: Provenance{Source: SourceEnvironment, Path: path}}, nil
+	}
+
+	return next(ctx, path)
+}
+
+// dispatch runs the watch interceptors around callback.
+func (c *confyImpl) dispatch(path string, v Value, callback func(v Value)) {
+	next := callback
+	for i := len(c.watchInterceptors) - 1; i >= 0; i-- {
+		interceptor, inner := c.watchInterceptors[i], next
+		next = func(v Value) {
+			interceptor(path, v, inner)
+		}
+	}
+
+	next(v)
+}
@@ -0,0 +1,94 @@
+package confy
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInterceptors(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"tenanta/app": {"user": "a-user"},
+		"app":         {"user": "shared-user"},
+	})
+	t.Setenv("TENANTA_APP_USER", "env-user")
+
+	var mu sync.Mutex
+	calls := []string{}
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, path string, next Invoker) (Value, error) {
+			mu.Lock()
+			calls = append(calls, name+":"+path)
+			mu.Unlock()
+			return next(ctx, path)
+		}
+	}
+	scope := func(ctx context.Context, path string, next Invoker) (Value, error) {
+		return next(ctx, "tenanta/"+path)
+	}
+
+	config := New(fake.client(t), time.Minute, false, WithInterceptors(record("outer"), scope, record("inner")))
+	defer config.Close()
+
+	v, err := config.Get(context.Background(), "secret/app#user")
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	if v.String() != "a-user" {
+		t.Fatalf("expected the scoped value; got '%s'", v.String())
+	}
+	if strings.Join(calls, ",") != "outer:app#user,inner:tenanta/app#user" {
+		t.Fatalf("interceptors ran out of order: %v", calls)
+	}
+
+	t.Run("interceptors run before the env override", func(t *testing.T) {
+		config := New(fake.client(t), time.Minute, true, WithInterceptors(scope))
+		defer config.Close()
+
+		v, err := config.Get(context.Background(), "app#user")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if v.String() != "env-user" {
+			t.Fatalf("expected the override of the scoped path; got '%s'", v.String())
+		}
+	})
+}
+
+func TestWatchInterceptors(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"test/app": {"flag": "off"},
+	})
+
+	intercepted := make(chan string, 1)
+	config := new(fake.client(t), time.Second, false, WithWatchInterceptors(func(path string, v Value, next func(Value)) {
+		intercepted <- path
+		next(v)
+	}))
+	defer config.Close()
+
+	called := make(chan string, 1)
+	cancel := config.Watch("test/app#flag", func(oldVal, newVal Value) bool {
+		return oldVal.String() != newVal.String()
+	}, func(v Value) {
+		called <- v.String()
+	})
+	defer cancel()
+
+	time.Sleep(100 * time.Millisecond)
+	fake.put("test/app", map[string]any{"flag": "on"})
+
+	select {
+	case path := <-intercepted:
+		if path != "test/app#flag" {
+			t.Fatalf("unexpected path '%s'", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the watch interceptor")
+	}
+	if v := <-called; v != "on" {
+		t.Fatalf("expected 'on'; got '%s'", v)
+	}
+}
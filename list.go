@@ -0,0 +1,72 @@
+package confy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Lister is implemented by the clients returned by New.
+type Lister interface {
+	// List returns the paths of every document under prefix in the KV engine mounted at
+	// secret/, recursively and sorted, without the secret/ prefix. The documents are not read.
+	// Clients created with WithBackend list the documents of their backend instead, if it
+	// implements Lister.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// BundleSource is what CreateBundle exports documents from, such as the clients
+// returned by New.
+type BundleSource interface {
+	Getter
+	Lister
+}
+
+func (c *confyImpl) List(ctx context.Context, prefix string) ([]string, error) {
+	if l, ok := c.backend.(Lister); ok {
+		return l.List(ctx, prefix)
+	}
+	if c.client == nil {
+		return nil, errNoVaultClient
+	}
+
+	return c.listMount(ctx, "secret", strings.TrimPrefix(prefix, "secret/"))
+}
+
+// listMount lists the documents under prefix below the given path, recursively and
+// sorted: the mount itself for KV v1, or its metadata/ path for KV v2.
+func (c *confyImpl) listMount(ctx context.Context, mount, prefix string) ([]string, error) {
+	paths := []string{}
+	if err := c.list(ctx, mount, strings.Trim(prefix, "/"), &paths); err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+func (c *confyImpl) list(ctx context.Context, mount, dir string, paths *[]string) error {
+	secret, err := c.client.RawClient().Logical().ListWithContext(ctx, strings.TrimSuffix(mount+"/"+dir, "/"))
+	if err != nil {
+		return fmt.Errorf("could not list '%s' in Vault: %w", dir, c.loginError(err))
+	}
+	if secret == nil || secret.Data == nil {
+		return nil
+	}
+
+	keys, _ := secret.Data["keys"].([]any)
+	for _, k := range keys {
+		key, _ := k.(string)
+		child := strings.TrimPrefix(dir+"/"+key, "/")
+		if strings.HasSuffix(key, "/") {
+			if err := c.list(ctx, mount, strings.TrimSuffix(child, "/"), paths); err != nil {
+				return err
+			}
+			continue
+		}
+		*paths = append(*paths, child)
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package confy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"search/prod/app": {"user": "a"},
+		"search/prod/db":  {"user": "b"},
+		"search/dev/app":  {"user": "c"},
+		"search":          {"user": "d"},
+		"other/app":       {"user": "e"},
+	})
+	c := new(fake.client(t), time.Minute, false)
+	defer c.Close()
+
+	paths, err := c.(Lister).List(context.Background(), "secret/search/")
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"search/dev/app", "search/prod/app", "search/prod/db"}) {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+
+	if paths, err := c.(Lister).List(context.Background(), "missing"); err != nil || len(paths) != 0 {
+		t.Fatalf("expected no paths; got %v, %v", paths, err)
+	}
+}
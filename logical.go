@@ -0,0 +1,144 @@
+package confy
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// LogicalOptions changes how Logical reaches a path. A nil *LogicalOptions is a cached read.
+type LogicalOptions struct {
+	// Write sends Data to the path instead of reading it. Writes are never cached; the
+	// response (which may be empty) is returned as the value, and cached reads of the
+	// path, whatever their Params, are dropped, as is the KV document for paths under
+	// secret/.
+	Write bool
+	Data  map[string]any
+	// Params are sent as query parameters on reads, e.g. url.Values{"version": {"2"}}.
+	// Reads with different parameters are cached separately.
+	Params url.Values
+	// NoCache reads the path from Vault even if it is cached, and refreshes the cache.
+	NoCache bool
+}
+
+// LogicalClient is implemented by the clients returned by New. It reaches any Vault path,
+// such as sys/, identity/ or transit/ endpoints and custom plugins, rather than only the
+// KV engine mounted at secret/.
+type LogicalClient interface {
+	// Logical reads (or writes, see LogicalOptions) the full Vault path, including the mount,
+	// e.g. "transit/keys/app#latest_version". The path#field notation, caching and Value
+	// coercion work as they do for Get. Environment overrides and interceptors do not apply.
+	Logical(ctx context.Context, path string, opts *LogicalOptions) (Value, error)
+	// WatchLogical is the Watch counterpart of Logical. Only reads can be watched.
+	WatchLogical(path string, opts *LogicalOptions, comparator func(oldval, newval Value) bool, callback func(v Value)) context.CancelFunc
+}
+
+// logicalKey returns the cache key of a logical path. KV documents are cached by their path
+// under secret/, which never starts with a slash, so logical paths cannot collide with them.
+func logicalKey(path string, params url.Values) string {
+	key := "/" + strings.Trim(path, "/")
+	if len(params) > 0 {
+		key += "?" + params.Encode()
+	}
+
+	return key
+}
+
+// readLogical reads the logical path behind a key returned by logicalKey.
+func (c *confyImpl) readLogical(ctx context.Context, key string) (*vaultapi.Secret, error) {
+	path, query, _ := strings.Cut(strings.TrimPrefix(key, "/"), "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.client == nil {
+		return nil, errNoVaultClient
+	}
+	secret, err := c.client.RawClient().Logical().ReadWithDataWithContext(ctx, path, params)
+	if err != nil {
+		return nil, fmt.Errorf("could not read '%s' from Vault: %w", path, c.loginError(err))
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("path '%s' was %w in Vault", path, ErrNotFound)
+	}
+
+	return secret, nil
+}
+
+func (c *confyImpl) Logical(ctx context.Context, path string, opts *LogicalOptions) (Value, error) {
+	if opts == nil {
+		opts = &LogicalOptions{}
+	}
+	path, fieldName, _ := strings.Cut(path, "#")
+
+	if opts.Write {
+		return c.writeLogical(ctx, path, fieldName, opts.Data)
+	}
+
+	key := logicalKey(path, opts.Params)
+	if opts.NoCache {
+		c.cache.Delete(key)
+	}
+
+	return c.load(ctx, key, fieldName)
+}
+
+func (c *confyImpl) writeLogical(ctx context.Context, path, fieldName string, data map[string]any) (Value, error) {
+	path = strings.Trim(path, "/")
+	if c.client == nil {
+		return nil, errNoVaultClient
+	}
+	start := time.Now()
+	secret, err := c.client.RawClient().Logical().WriteWithContext(ctx, path, data)
+	c.metrics.request("write", path, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("could not write '%s' to Vault: %w", path, c.loginError(err))
+	}
+	c.dropLogical(path)
+
+	resp := map[string]any{}
+	if secret != nil && secret.Data != nil {
+		resp = secret.Data
+	}
+	if fieldName != "" {
+		f, ok := lookupField(resp, fieldName)
+		if !ok {
+			return nil, fmt.Errorf("field '%s' in the response of '%s' was %w", fieldName, path, ErrNotFound)
+		}
+		return &value{val: f, set: true, provenance: Provenance{Source: SourceVault, Path: path + "#" + fieldName}}, nil
+	}
+
+	return &value{val: resp, set: true, provenance: Provenance{Source: SourceVault, Path: path}}, nil
+}
+
+// dropLogical drops the cached reads of path, with any parameters, and the KV document it
+// is if it is under secret/.
+func (c *confyImpl) dropLogical(path string) {
+	key := logicalKey(path, nil)
+	for _, k := range c.cache.Keys() {
+		if k == key || strings.HasPrefix(k, key+"?") {
+			c.cache.Delete(k)
+		}
+	}
+	if doc := strings.TrimPrefix(path, "secret/"); doc != path {
+		c.cache.Delete(doc)
+	}
+}
+
+func (c *confyImpl) WatchLogical(path string, opts *LogicalOptions, comparator func(oldval, newval Value) bool, callback func(v Value)) context.CancelFunc {
+	read := LogicalOptions{}
+	if opts != nil {
+		read.Params = opts.Params
+	}
+	get := func(ctx context.Context, path string) (Value, error) {
+		return c.Logical(ctx, path, &read)
+	}
+
+	docPath, _, _ := strings.Cut(path, "#")
+	return c.watch(path, []string{logicalKey(docPath, read.Params)}, get, comparator, callback)
+}
@@ -0,0 +1,166 @@
+package confy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLogical(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"sys/mounts": {"user": "kv-user"},
+	})
+
+	var mu sync.Mutex
+	reads := 0
+	latest := 1
+	fake.handle("/v1/transit/keys/app", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			reads++
+			writeJSON(w, map[string]any{"data": map[string]any{
+				"latest_version": latest,
+				"version":        r.URL.Query().Get("version"),
+				"keys":           map[string]any{"1": 1700000000},
+			}})
+		default:
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			latest++
+			writeJSON(w, map[string]any{"data": map[string]any{"rotated": body["reason"]}})
+		}
+	}))
+	readCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return reads
+	}
+
+	reg := prometheus.NewRegistry()
+	c := new(fake.client(t), time.Minute, false, WithMetrics(reg))
+	defer c.Close()
+	logical := c.(LogicalClient)
+	ctx := context.Background()
+
+	v, err := logical.Logical(ctx, "transit/keys/app#latest_version", nil)
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	if n, ok := v.Int(); !ok || n != 1 {
+		t.Fatalf("expected the latest version to be 1; got %v", v.Raw())
+	}
+
+	if _, err := logical.Logical(ctx, "transit/keys/app#keys.1", nil); err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	if readCount() != 1 {
+		t.Fatalf("expected fields of the same path to be read from the cache; got %d reads", readCount())
+	}
+
+	v, err = logical.Logical(ctx, "transit/keys/app#version", &LogicalOptions{Params: url.Values{"version": {"2"}}})
+	if err != nil || v.String() != "2" || readCount() != 2 {
+		t.Fatalf("expected the parameters to be sent and cached separately; got %v, %v, %d reads", v, err, readCount())
+	}
+
+	if _, err := logical.Logical(ctx, "transit/keys/app", &LogicalOptions{NoCache: true}); err != nil || readCount() != 3 {
+		t.Fatalf("expected NoCache to read from Vault; got %v, %d reads", err, readCount())
+	}
+
+	v, err = logical.Logical(ctx, "transit/keys/app#rotated", &LogicalOptions{Write: true, Data: map[string]any{"reason": "test"}})
+	if err != nil || v.String() != "test" {
+		t.Fatalf("expected the write response; got %v, %v", v, err)
+	}
+	v, err = logical.Logical(ctx, "transit/keys/app#latest_version", nil)
+	if n, _ := v.Int(); err != nil || n != 2 {
+		t.Fatalf("expected the write to drop the cached read; got %v, %v", v, err)
+	}
+	before := readCount()
+	v, err = logical.Logical(ctx, "transit/keys/app#latest_version", &LogicalOptions{Params: url.Values{"version": {"2"}}})
+	if n, _ := v.Int(); err != nil || n != 2 || readCount() != before+1 {
+		t.Fatalf("expected the write to drop the cached reads with parameters; got %v, %v", v, err)
+	}
+
+	// Logical paths do not collide with KV documents of the same name.
+	if v, err := c.Get(ctx, "sys/mounts#user"); err != nil || v.String() != "kv-user" {
+		t.Fatalf("expected the KV document; got %v, %v", v, err)
+	}
+
+	// Writes under secret/ drop the cached KV document.
+	if _, err := logical.Logical(ctx, "secret/sys/mounts", &LogicalOptions{Write: true, Data: map[string]any{"user": "new-user"}}); err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	if v, err := c.Get(ctx, "sys/mounts#user"); err != nil || v.String() != "new-user" {
+		t.Fatalf("expected the write to drop the KV document; got %v, %v", v, err)
+	}
+
+	if _, err := logical.Logical(ctx, "identity/entity/name/missing", nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a not found error; got %v", err)
+	}
+
+	families, _ := reg.Gather()
+	recorded := map[string]uint64{}
+	for _, family := range families {
+		if family.GetName() != "confy_vault_request_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := []string{}
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetValue())
+			}
+			recorded[strings.Join(labels, ",")] = m.GetHistogram().GetSampleCount()
+		}
+	}
+	// Labels are sorted by name: mount, operation, outcome.
+	for _, labels := range []string{"transit,read,success", "transit,write,success", "secret,read,success", "identity,read,not_found"} {
+		if recorded[labels] == 0 {
+			t.Fatalf("expected requests to be recorded for %s; got %v", labels, recorded)
+		}
+	}
+}
+
+func TestWatchLogical(t *testing.T) {
+	fake := newFakeVault(t, nil)
+	var mu sync.Mutex
+	state := "active"
+	fake.handle("/v1/sys/leader", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		writeJSON(w, map[string]any{"data": map[string]any{"state": state}})
+	}))
+
+	c := new(fake.client(t), 100*time.Millisecond, false)
+	defer c.Close()
+
+	changed := make(chan string, 1)
+	cancel := c.(LogicalClient).WatchLogical("sys/leader#state", nil, func(oldVal, newVal Value) bool {
+		return oldVal.String() != newVal.String()
+	}, func(v Value) {
+		changed <- v.String()
+	})
+	defer cancel()
+
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	state = "standby"
+	mu.Unlock()
+
+	select {
+	case s := <-changed:
+		if s != "standby" {
+			t.Fatalf("expected the new state; got %s", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the watch")
+	}
+}
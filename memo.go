@@ -0,0 +1,309 @@
+package confy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// documents keeps track of the content of every document loaded from Vault.
+// A document's generation only changes when its content changes, so that
+// values derived from it (parsed certificates, keys, etc.) can be kept
+// around across cache refreshes that bring back the same content.
+type documents struct {
+	// hashKey keys the hashes published in DocumentInfo (see WithDocumentHashKey).
+	hashKey []byte
+
+	mu    sync.Mutex
+	state map[string]*document
+	memo  map[memoKey]memoEntry
+	// missing holds the documents that were not found the last time they were read.
+	missing map[string]bool
+}
+
+type document struct {
+	hash          string
+	publicHash    string
+	generation    uint64
+	version       int64
+	source        string
+	sourceVersion string
+	data          map[string]any
+	loadedAt      time.Time
+	changedAt     time.Time
+}
+
+// DocumentInfo describes the content of a loaded document without revealing it, so
+// that replicas can be compared with each other.
+type DocumentInfo struct {
+	Path string `json:"path"`
+	// Hash is the HMAC-SHA256 of the document's content, keyed with the key given to
+	// WithDocumentHashKey. It is empty without one.
+	Hash string `json:"hash,omitempty"`
+	// Version is the KV v2 version of the document, when known.
+	Version int64 `json:"version,omitempty"`
+	// Generation is incremented by the client every time the document's content changes.
+	Generation uint64 `json:"generation"`
+	// LoadedAt is when the document was last read from Vault.
+	LoadedAt time.Time `json:"loaded_at"`
+	// ChangedAt is when the client first saw the current content of the document.
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// DocumentReporter is implemented by the clients returned by New. Documents describes
+// every document loaded so far, sorted by path.
+type DocumentReporter interface {
+	Documents() []DocumentInfo
+}
+
+// WithDocumentHashKey sets the key of the content hashes reported by Documents and the
+// confy_document_info metric. Replicas must share the key for their hashes to be compared,
+// e.g. by `confy fleet-check`, and it must be kept secret: it is what prevents anyone who
+// sees the hashes from checking guesses of a document's secrets against them. Without a
+// key, no hash is reported.
+func WithDocumentHashKey(key []byte) Option {
+	return func(c *confyImpl) {
+		c.docs.hashKey = append([]byte(nil), key...)
+	}
+}
+
+func (doc *document) info(path string) DocumentInfo {
+	return DocumentInfo{
+		Path:       path,
+		Hash:       doc.publicHash,
+		Version:    doc.version,
+		Generation: doc.generation,
+		LoadedAt:   doc.loadedAt,
+		ChangedAt:  doc.changedAt,
+	}
+}
+
+// loadedDocument is the content of a document, together with its generation, so that
+// values read from it are memoized against the generation they were read from.
+type loadedDocument struct {
+	data       map[string]any
+	generation uint64
+}
+
+type memoKey struct {
+	path  string
+	field string
+	kind  string
+	// typ is the type of the result, so that parsers of different types can share a kind.
+	typ reflect.Type
+}
+
+type memoEntry struct {
+	generation uint64
+	val        any
+	err        error
+}
+
+func newDocuments() *documents {
+	return &documents{state: map[string]*document{}, memo: map[memoKey]memoEntry{}, missing: map[string]bool{}}
+}
+
+// observe records the content of the document at path. It returns the resulting
+// description of the document, and whether its content changed. Memoized values
+// derived from an older generation of the document are dropped.
+func (d *documents) observe(path string, data map[string]any, source, version string) (DocumentInfo, bool) {
+	hash := contentHash(data)
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.missing, path)
+	doc, ok := d.state[path]
+	if !ok {
+		doc = &document{}
+		d.state[path] = doc
+	}
+
+	doc.loadedAt = now
+	doc.source, doc.sourceVersion = source, version
+	doc.data = data
+	changed := doc.hash != hash
+	if changed {
+		doc.hash = hash
+		doc.publicHash = keyedHash(d.hashKey, data)
+		doc.generation++
+		doc.version = kvVersion(data)
+		doc.changedAt = now
+		for k := range d.memo {
+			if k.path == path {
+				delete(d.memo, k)
+			}
+		}
+	}
+
+	return doc.info(path), changed
+}
+
+// list describes every document, sorted by path.
+func (d *documents) list() []DocumentInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	infos := make([]DocumentInfo, 0, len(d.state))
+	for path, doc := range d.state {
+		infos = append(infos, doc.info(path))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+
+	return infos
+}
+
+// content returns the last loaded content of the document at path, or nil.
+func (d *documents) content(path string) map[string]any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if doc, ok := d.state[path]; ok {
+		return doc.data
+	}
+
+	return nil
+}
+
+// current returns the last loaded content of the document at path, and its generation.
+func (d *documents) current(path string) (loadedDocument, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if doc, ok := d.state[path]; ok {
+		return loadedDocument{data: doc.data, generation: doc.generation}, true
+	}
+
+	return loadedDocument{}, false
+}
+
+// observeMissing records that the document at path was not found.
+func (d *documents) observeMissing(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.missing[path] = true
+}
+
+// snapshot returns the last loaded content of every document, by path, and the paths of
+// the documents that were not found.
+func (d *documents) snapshot() (map[string]loadedDocument, map[string]bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	snapshot := make(map[string]loadedDocument, len(d.state))
+	for path, doc := range d.state {
+		snapshot[path] = loadedDocument{data: doc.data, generation: doc.generation}
+	}
+	missing := make(map[string]bool, len(d.missing))
+	for path := range d.missing {
+		missing[path] = true
+	}
+
+	return snapshot, missing
+}
+
+// kvVersion returns the version found in the metadata of a KV v2 read, or 0.
+func kvVersion(data map[string]any) int64 {
+	meta, ok := data["metadata"].(map[string]any)
+	if !ok {
+		return 0
+	}
+
+	n, ok := meta["version"].(json.Number)
+	if !ok {
+		return 0
+	}
+
+	v, _ := n.Int64()
+	return v
+}
+
+// memoize returns the result of fn for key, computing it only once per generation
+// of the document.
+func (d *documents) memoize(key memoKey, generation uint64, fn func() (any, error)) (any, error) {
+	d.mu.Lock()
+	entry, ok := d.memo[key]
+	d.mu.Unlock()
+	if ok && entry.generation == generation {
+		return entry.val, entry.err
+	}
+
+	val, err := fn()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Only keep results computed from the current generation of the document.
+	if doc, ok := d.state[key.path]; ok && doc.generation == generation {
+		d.memo[key] = memoEntry{generation: generation, val: val, err: err}
+	}
+
+	return val, err
+}
+
+// contentHash returns a stable hash of a document's content, used to detect changes.
+// Map keys are sorted by encoding/json, so equal documents hash the same. It is never
+// published, since it could be used to check guesses of the document's secrets.
+func contentHash(data map[string]any) string {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// keyedHash returns the HMAC-SHA256 of a document's content with key, or an empty string
+// without a key.
+func keyedHash(key []byte, data map[string]any) string {
+	if len(key) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// origin records where a value came from, so derived forms of it can be memoized.
+type origin struct {
+	docs       *documents
+	path       string
+	field      string
+	generation uint64
+}
+
+// Memoize parses v with parse, caching the result by the path and field the value
+// was read from, by key, which names the parser (e.g. "regexp" or "url"), and by T.
+// The cached result is dropped automatically once the document is refreshed from Vault
+// with different content, so it is safe to call on hot paths:
+//
+//	re, err := confy.Memoize(v, "regexp", func(v confy.Value) (*regexp.Regexp, error) {
+//		return regexp.Compile(v.String())
+//	})
+//
+// Values that did not come from Vault (e.g. environment overrides or fallbacks) are
+// parsed every time. Cached results are shared between callers and must not be modified.
+func Memoize[T any](v Value, key string, parse func(Value) (T, error)) (T, error) {
+	vv, ok := v.(*value)
+	if !ok || vv.origin == nil {
+		return parse(v)
+	}
+
+	o := vv.origin
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	res, err := o.docs.memoize(memoKey{path: o.path, field: o.field, kind: key, typ: typ}, o.generation, func() (any, error) {
+		return parse(v)
+	})
+	t, ok := res.(T)
+	if !ok && err == nil {
+		// Nil interface results do not assert to T; never return a zero T without an error.
+		return parse(v)
+	}
+	return t, err
+}
@@ -0,0 +1,99 @@
+package confy
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMemoize(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"test/memo": {"endpoint": "https://example.com/a", "timeout": "3s"},
+	})
+	config := new(fake.client(t), time.Second, false)
+	defer config.Close()
+	ctx := context.Background()
+
+	parses := 0
+	parse := func(v Value) (*url.URL, error) {
+		parses++
+		return url.Parse(v.String())
+	}
+	get := func() *url.URL {
+		v, err := config.Get(ctx, "test/memo#endpoint")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		u, err := Memoize(v, "url", parse)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		return u
+	}
+
+	first := get()
+	if get() != first || parses != 1 {
+		t.Fatalf("expected the parsed url to be reused; parsed %d times", parses)
+	}
+
+	// A refresh that brings back the same content keeps the memoized value.
+	time.Sleep(1500 * time.Millisecond)
+	if get() != first || parses != 1 {
+		t.Fatalf("expected the parsed url to survive a refresh; parsed %d times", parses)
+	}
+	if fake.readCount("test/memo") < 2 {
+		t.Fatalf("expected the document to be re-read from Vault")
+	}
+
+	// New content invalidates it.
+	fake.put("test/memo", map[string]any{"endpoint": "https://example.com/b", "timeout": "3s"})
+	time.Sleep(1500 * time.Millisecond)
+	if u := get(); u.Path != "/b" || parses != 2 {
+		t.Fatalf("expected the url to be parsed again; got '%s' after %d parses", u, parses)
+	}
+
+	t.Run("same key with different types", func(t *testing.T) {
+		v, err := config.Get(ctx, "test/memo#endpoint")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		s, err := Memoize(v, "url", func(v Value) (string, error) { return "as string", nil })
+		if err != nil || s != "as string" {
+			t.Fatalf("expected the string parser to run; got %q, %v", s, err)
+		}
+		if u := get(); u == nil || u.Path != "/b" {
+			t.Fatalf("expected the url to still be memoized; got %v", u)
+		}
+	})
+
+	t.Run("env overrides are not memoized", func(t *testing.T) {
+		n := 0
+		v := &value{val: "1s", set: true}
+		for i := 0; i < 2; i++ {
+			_, _ = Memoize(v, "count", func(Value) (int, error) { n++; return n, nil })
+		}
+		if n != 2 {
+			t.Fatalf("expected the value to be parsed every time")
+		}
+	})
+}
+
+func TestDocumentHashKey(t *testing.T) {
+	data := map[string]any{"password": "hunter22"}
+	for name, key := range map[string][]byte{"no key": nil, "key": []byte("fleet-key"), "other key": []byte("other-key")} {
+		d := newDocuments()
+		d.hashKey = key
+		info, _ := d.observe("app", data, SourceVault, "")
+		switch {
+		case key == nil && info.Hash != "":
+			t.Fatalf("expected no hash without a key; got %s", info.Hash)
+		case key != nil && (info.Hash == "" || info.Hash == contentHash(data)):
+			t.Fatalf("expected a keyed hash with %s; got %q", name, info.Hash)
+		}
+	}
+
+	if keyedHash([]byte("fleet-key"), data) == keyedHash([]byte("other-key"), data) {
+		t.Fatalf("expected the hash to depend on the key")
+	}
+}
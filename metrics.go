@@ -0,0 +1,178 @@
+package confy
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "confy"
+
+// WithMetrics registers confy's Prometheus metrics with reg. No metrics are
+// collected by default. Registering several clients with the same registerer
+// is fine; they share the same collectors.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(c *confyImpl) {
+		c.metrics = newMetrics(reg)
+	}
+}
+
+// metrics holds the collectors confy reports to. All of its methods are safe to
+// call on a nil *metrics, which is what clients without WithMetrics use.
+type metrics struct {
+	envOverrides        *prometheus.GaugeVec
+	envOverridesBlocked *prometheus.CounterVec
+	expiries            *prometheus.GaugeVec
+	documents           *prometheus.GaugeVec
+	requests            *prometheus.HistogramVec
+	configInfo          *prometheus.GaugeVec
+	configValues        *prometheus.GaugeVec
+	hedgedReads         *prometheus.CounterVec
+	hedgeDelays         prometheus.Gauge
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	return &metrics{
+		envOverrides: register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "env_override_active",
+			Help:      "Set to 1 for every path whose value is overridden from the environment.",
+		}, []string{"path", "env"})),
+		envOverridesBlocked: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "env_override_blocked_total",
+			Help:      "Number of lookups where an environment override was present but not allowed.",
+		}, []string{"path", "reason"})),
+		expiries: register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "secret_expiry_timestamp_seconds",
+			Help:      "Unix timestamp at which a secret expires.",
+		}, []string{"path", "field", "source"})),
+		documents: register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "document_info",
+			Help:      "Set to 1 for the current content hash (see WithDocumentHashKey) and KV version of every loaded document.",
+		}, []string{"path", "hash", "version"})),
+		requests: register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "vault_request_duration_seconds",
+			Help:      "Duration of the requests sent to Vault, by operation, mount and outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "mount", "outcome"})),
+		configInfo: register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "config_info",
+			Help:      "Set to 1 for the current value of every field marked as non-secret.",
+		}, []string{"path", "field", "value"})),
+		configValues: register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "config_value",
+			Help:      "Current value of every numeric field marked as non-secret. Booleans are 0 or 1, and durations are in seconds.",
+		}, []string{"path", "field"})),
+		hedgedReads: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "vault_hedged_reads_total",
+			Help:      "Number of reads from Vault that took long enough to be hedged, by outcome: won (the hedged read answered first), lost, failed (both failed) or throttled (not sent, the hedge budget was spent).",
+		}, []string{"outcome"})),
+		hedgeDelays: register(reg, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "vault_hedge_delay_seconds",
+			Help:      "Current delay after which reads from Vault are hedged.",
+		})),
+	}
+}
+
+// register registers c with reg, returning the collector that was registered
+// before if there is one.
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+
+	return c
+}
+
+func (m *metrics) overrideActive(path, env string) {
+	if m != nil {
+		m.envOverrides.WithLabelValues(path, env).Set(1)
+	}
+}
+
+func (m *metrics) overrideBlocked(path, reason string) {
+	if m != nil {
+		m.envOverridesBlocked.WithLabelValues(path, reason).Inc()
+	}
+}
+
+func (m *metrics) expiry(e Expiry) {
+	if m != nil {
+		m.expiries.WithLabelValues(e.Path, e.Field, e.Source).Set(float64(e.ExpiresAt.Unix()))
+	}
+}
+
+func (m *metrics) expiryRemoved(e Expiry) {
+	if m != nil {
+		m.expiries.DeleteLabelValues(e.Path, e.Field, e.Source)
+	}
+}
+
+func (m *metrics) document(info DocumentInfo) {
+	if m != nil {
+		m.documents.DeletePartialMatch(prometheus.Labels{"path": info.Path})
+		m.documents.WithLabelValues(info.Path, info.Hash, strconv.FormatInt(info.Version, 10)).Set(1)
+	}
+}
+
+// request records a request to Vault for path (including the mount) that started at start.
+func (m *metrics) request(operation, path string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	mount, _, _ := strings.Cut(path, "/")
+	outcome := "success"
+	switch {
+	case errors.Is(err, ErrNotFound):
+		outcome = "not_found"
+	case err != nil:
+		outcome = "error"
+	}
+	m.requests.WithLabelValues(operation, mount, outcome).Observe(time.Since(start).Seconds())
+}
+
+// config replaces the published non-secret fields of the document at path.
+func (m *metrics) config(path string, fields []configField) {
+	if m == nil {
+		return
+	}
+
+	m.configInfo.DeletePartialMatch(prometheus.Labels{"path": path})
+	m.configValues.DeletePartialMatch(prometheus.Labels{"path": path})
+	for _, f := range fields {
+		m.configInfo.WithLabelValues(path, f.field, f.value).Set(1)
+		if f.isNumeric {
+			m.configValues.WithLabelValues(path, f.field).Set(f.numeric)
+		}
+	}
+}
+
+func (m *metrics) hedgedRead(outcome string) {
+	if m != nil {
+		m.hedgedReads.WithLabelValues(outcome).Inc()
+	}
+}
+
+func (m *metrics) hedgeDelay(d time.Duration) {
+	if m != nil {
+		m.hedgeDelays.Set(d.Seconds())
+	}
+}
@@ -0,0 +1,66 @@
+package confy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Optional fetches the path and converts its value to T. The boolean return value
+// is false if the field is missing from the document or is explicitly null, in
+// which case the zero value of T is returned. An error is only returned if the
+// value could not be fetched for any other reason, or if it could not be coerced to T.
+//
+// Supported types are string, bool, int, int64, float64, time.Duration, []string,
+// map[string]string and map[string]any. Any other type is type asserted from the raw value.
+func Optional[T any](ctx context.Context, g Getter, path string) (T, bool, error) {
+	var zero T
+	v, err := g.Get(ctx, path)
+	if errors.Is(err, ErrNotFound) {
+		return zero, false, nil
+	}
+	if err != nil {
+		return zero, false, err
+	}
+
+	if v.IsNull() {
+		return zero, false, nil
+	}
+
+	t, ok := convert[T](v)
+	if !ok {
+		return zero, false, fmt.Errorf("value on path '%s' could not be coerced to %T", path, zero)
+	}
+
+	return t, true, nil
+}
+
+func convert[T any](v Value) (T, bool) {
+	var t T
+	ok := true
+	switch p := any(&t).(type) {
+	case *string:
+		*p = v.String()
+	case *bool:
+		*p, ok = v.Bool()
+	case *int:
+		*p, ok = v.Int()
+	case *int64:
+		*p, ok = v.Int64()
+	case *float64:
+		*p, ok = v.Float64()
+	case *time.Duration:
+		*p, ok = v.Duration()
+	case *[]string:
+		*p, ok = v.StringSlice()
+	case *map[string]string:
+		*p, ok = v.Map()
+	case *map[string]any:
+		*p, ok = v.Data()
+	default:
+		t, ok = v.Raw().(T)
+	}
+
+	return t, ok
+}
@@ -0,0 +1,81 @@
+package confy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOptional(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"test/optional": {"user": "fake-user", "port": "8080", "empty": nil},
+	})
+	config := New(fake.client(t), time.Minute, false)
+	defer config.Close()
+	ctx := context.Background()
+
+	t.Run("present value", func(t *testing.T) {
+		port, ok, err := Optional[int](ctx, config, "test/optional#port")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if !ok || port != 8080 {
+			t.Fatalf("expected 8080; got %d (%t)", port, ok)
+		}
+	})
+
+	t.Run("null value", func(t *testing.T) {
+		s, ok, err := Optional[string](ctx, config, "test/optional#empty")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if ok || s != "" {
+			t.Fatalf("expected an unset value; got '%s' (%t)", s, ok)
+		}
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		_, ok, err := Optional[string](ctx, config, "test/optional#nope")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if ok {
+			t.Fatalf("expected an unset value")
+		}
+	})
+
+	t.Run("missing path", func(t *testing.T) {
+		_, ok, err := Optional[string](ctx, config, "test/nope#user")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if ok {
+			t.Fatalf("expected an unset value")
+		}
+	})
+
+	t.Run("coercion failure", func(t *testing.T) {
+		_, _, err := Optional[bool](ctx, config, "test/optional#user")
+		if err == nil {
+			t.Fatalf("expected an error")
+		}
+	})
+
+	t.Run("null semantics on the value", func(t *testing.T) {
+		v, err := config.Get(ctx, "test/optional#empty")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if !v.IsNull() || !v.IsSet() {
+			t.Fatalf("expected a set null value")
+		}
+		if v.String() != "" {
+			t.Fatalf("expected an empty string; got '%s'", v.String())
+		}
+
+		d, _ := config.GetOrDefault(ctx, "test/optional#nope", "fallback")
+		if d.IsSet() || d.IsNull() {
+			t.Fatalf("expected a fallback value to not be set")
+		}
+	})
+}
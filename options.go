@@ -0,0 +1,26 @@
+package confy
+
+import (
+	"github.com/bank-vaults/vault-sdk/vault"
+)
+
+// Option customizes the configuration client returned by New.
+type Option func(c *confyImpl)
+
+// WithLogger sets the logger used to report background activity, such as
+// reconnections to Vault's event stream. It uses the same interface as the
+// vault client, so the same logger can be shared by both. Nothing is logged by default.
+func WithLogger(logger vault.Logger) Option {
+	return func(c *confyImpl) {
+		c.logger = logger
+	}
+}
+
+// noopLogger discards every log event.
+type noopLogger struct{}
+
+func (noopLogger) Trace(_ string, _ ...map[string]any) {}
+func (noopLogger) Debug(_ string, _ ...map[string]any) {}
+func (noopLogger) Info(_ string, _ ...map[string]any)  {}
+func (noopLogger) Warn(_ string, _ ...map[string]any)  {}
+func (noopLogger) Error(_ string, _ ...map[string]any) {}
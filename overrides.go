@@ -0,0 +1,195 @@
+package confy
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons an environment override can be blocked for.
+const (
+	blockedByDenylist  = "denylist"
+	blockedByAllowlist = "allowlist"
+	blockedAsSecret    = "secret"
+)
+
+// WithEnvOverrideAllowlist restricts environment overrides to the paths matching the
+// given patterns. Patterns are globs such as "search/*/app#debug" or "search/app"; see
+// WithSecretFields for the full syntax. Overrides for any other path are ignored and the
+// value is read from Vault.
+//
+// When the client is created, the environment variables that can override a path allowed
+// by these patterns are logged, and literal patterns (without glob characters) are checked
+// so that their overrides are reported by Overrides up front.
+func WithEnvOverrideAllowlist(patterns ...string) Option {
+	return func(c *confyImpl) {
+		c.overrides.allow = append(c.overrides.allow, patterns...)
+	}
+}
+
+// WithEnvOverrideDenylist prevents the paths matching the given patterns from being
+// overridden from the environment. It takes precedence over the allowlist.
+func WithEnvOverrideDenylist(patterns ...string) Option {
+	return func(c *confyImpl) {
+		c.overrides.deny = append(c.overrides.deny, patterns...)
+	}
+}
+
+// WithSecretFields marks the fields matching the given patterns as secret. Patterns are
+// matched with path.Match against the Get path: "db/*#password" matches the password field
+// of any document directly under db/, while a pattern without a field name, like "db/app",
+// matches every field of that document. * does not match slashes.
+func WithSecretFields(patterns ...string) Option {
+	return func(c *confyImpl) {
+		c.secrets = append(c.secrets, patterns...)
+	}
+}
+
+// WithNoSecretOverrides prevents fields marked with WithSecretFields from being
+// overridden from the environment.
+func WithNoSecretOverrides() Option {
+	return func(c *confyImpl) {
+		c.overrides.noSecrets = true
+	}
+}
+
+// Override describes a path whose value is being served from the environment.
+type Override struct {
+	Path   string    `json:"path"`
+	EnvVar string    `json:"env_var"`
+	Since  time.Time `json:"since"`
+}
+
+// OverrideReporter is implemented by the clients returned by New. Overrides lists the
+// environment overrides seen so far, sorted by path.
+type OverrideReporter interface {
+	Overrides() []Override
+}
+
+// envOverrides holds the environment override policy and the overrides seen so far.
+type envOverrides struct {
+	allow     pathPatterns
+	deny      pathPatterns
+	noSecrets bool
+
+	mu      sync.Mutex
+	active  map[string]Override
+	blocked map[string]bool
+}
+
+// envKey returns the name of the environment variable that overrides path.
+func envKey(path string) string {
+	return strings.ToUpper(replacer.Replace(path))
+}
+
+// lookupOverride returns the environment override for path, if there is one and the
+// policy allows it. path must not have the secret/ prefix.
+func (c *confyImpl) lookupOverride(path string) (string, bool) {
+	key := envKey(path)
+	envValue := os.Getenv(key)
+	if envValue == "" {
+		return "", false
+	}
+
+	o := &c.overrides
+	reason := ""
+	switch {
+	case o.deny.match(path):
+		reason = blockedByDenylist
+	case len(o.allow) > 0 && !o.allow.match(path):
+		reason = blockedByAllowlist
+	case o.noSecrets && c.secrets.match(path):
+		reason = blockedAsSecret
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if reason != "" {
+		c.metrics.overrideBlocked(path, reason)
+		if !o.blocked[path] {
+			o.blocked[path] = true
+			c.logger.Warn("ignoring environment override", map[string]any{"path": path, "env": key, "reason": reason})
+		}
+		return "", false
+	}
+
+	if _, ok := o.active[path]; !ok {
+		o.active[path] = Override{Path: path, EnvVar: key, Since: time.Now()}
+		c.metrics.overrideActive(path, key)
+		c.logger.Info("value overridden from the environment", map[string]any{"path": path, "env": key})
+	}
+
+	return envValue, true
+}
+
+// reportOverrides logs the environment variables that can override values when the client
+// is created. Overrides are only resolved as paths are read, so with an allowlist the
+// variables matching its patterns are reported as candidates, and the literal patterns
+// are checked up front. Without an allowlist any variable can be an override, and they are
+// only logged as they are read.
+func (c *confyImpl) reportOverrides() {
+	if len(c.overrides.allow) == 0 {
+		c.logger.Info("environment overrides enabled for every path; they are logged as they are read")
+		return
+	}
+
+	for _, path := range c.overrides.allow.literal() {
+		c.lookupOverride(path)
+	}
+
+	active := c.Overrides()
+	paths := make([]string, len(active))
+	for i, o := range active {
+		paths[i] = o.Path
+	}
+	c.logger.Info("environment overrides", map[string]any{
+		"active":     paths,
+		"candidates": c.overrides.candidates(os.Environ()),
+	})
+}
+
+// candidates returns the names of the variables in environ that can override a path
+// allowed by the allowlist. Patterns without a field also match the variables of
+// their fields. The denylist and secret fields are only applied when the path is read.
+func (o *envOverrides) candidates(environ []string) []string {
+	globs := []string{}
+	for _, pattern := range o.allow {
+		glob := envKey(strings.TrimPrefix(pattern, "secret/"))
+		globs = append(globs, glob)
+		if !strings.Contains(pattern, "#") {
+			globs = append(globs, glob+"_*")
+		}
+	}
+
+	names := []string{}
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if value == "" {
+			continue
+		}
+		for _, glob := range globs {
+			if ok, _ := path.Match(glob, name); ok {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (c *confyImpl) Overrides() []Override {
+	c.overrides.mu.Lock()
+	defer c.overrides.mu.Unlock()
+	overrides := make([]Override, 0, len(c.overrides.active))
+	for _, o := range c.overrides.active {
+		overrides = append(overrides, o)
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Path < overrides[j].Path })
+
+	return overrides
+}
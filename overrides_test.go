@@ -0,0 +1,102 @@
+package confy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEnvOverridePolicy(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"db/app":  {"user": "vault-user", "password": "vault-password", "pool": "5"},
+		"web/app": {"debug": "false"},
+	})
+	t.Setenv("DB_APP_USER", "env-user")
+	t.Setenv("DB_APP_PASSWORD", "env-password")
+	t.Setenv("DB_APP_POOL", "10")
+	t.Setenv("WEB_APP_DEBUG", "true")
+
+	reg := prometheus.NewRegistry()
+	config := New(fake.client(t), time.Minute, true,
+		WithMetrics(reg),
+		WithEnvOverrideAllowlist("db/app", "web/app#debug"),
+		WithEnvOverrideDenylist("db/app#pool"),
+		WithSecretFields("db/*#password"),
+		WithNoSecretOverrides(),
+	)
+	defer config.Close()
+	ctx := context.Background()
+
+	t.Run("startup report", func(t *testing.T) {
+		overrides := config.(OverrideReporter).Overrides()
+		if len(overrides) != 1 || overrides[0].Path != "web/app#debug" || overrides[0].EnvVar != "WEB_APP_DEBUG" {
+			t.Fatalf("expected the literal allowlist entry to be reported; got %+v", overrides)
+		}
+	})
+
+	for path, expected := range map[string]string{
+		"db/app#user":     "env-user",
+		"db/app#password": "vault-password",
+		"db/app#pool":     "5",
+		"web/app#debug":   "true",
+	} {
+		v, err := config.Get(ctx, path)
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		if v.String() != expected {
+			t.Fatalf("on %s expected '%s'; got '%s'", path, expected, v.String())
+		}
+	}
+
+	if n := len(config.(OverrideReporter).Overrides()); n != 2 {
+		t.Fatalf("expected 2 active overrides; got %d", n)
+	}
+
+	active := testutil.ToFloat64(newMetrics(reg).envOverrides.WithLabelValues("db/app#user", "DB_APP_USER"))
+	if active != 1 {
+		t.Fatalf("expected the override to be reported as active")
+	}
+	blocked := testutil.ToFloat64(newMetrics(reg).envOverridesBlocked.WithLabelValues("db/app#password", blockedAsSecret))
+	if blocked != 1 {
+		t.Fatalf("expected the secret override to be reported as blocked; got %f", blocked)
+	}
+}
+
+func TestEnvOverrideCandidates(t *testing.T) {
+	o := envOverrides{allow: pathPatterns{"db/app", "web/*#debug", "secret/cache#ttl"}}
+	environ := []string{
+		"DB_APP=x",
+		"DB_APP_PASSWORD=env-password",
+		"DB_APPS_USER=x",
+		"WEB_APP_DEBUG=true",
+		"WEB_APP_MODE=fast",
+		"CACHE_TTL=",
+		"HOME=/root",
+	}
+	got := strings.Join(o.candidates(environ), ",")
+	if expected := "DB_APP,DB_APP_PASSWORD,WEB_APP_DEBUG"; got != expected {
+		t.Fatalf("expected the candidates to be %s; got %s", expected, got)
+	}
+}
+
+func TestPathPatterns(t *testing.T) {
+	patterns := pathPatterns{"db/*#password", "web/app"}
+	for path, expected := range map[string]bool{
+		"db/app#password":        true,
+		"secret/db/app#password": true,
+		"db/app#user":            false,
+		"db/app":                 false,
+		"db/a/b#password":        false,
+		"web/app":                true,
+		"web/app#debug":          true,
+	} {
+		if patterns.match(path) != expected {
+			t.Fatalf("expected match(%s) to be %t", path, expected)
+		}
+	}
+}
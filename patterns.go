@@ -0,0 +1,46 @@
+package confy
+
+import (
+	"path"
+	"strings"
+)
+
+// pathPatterns is a list of glob patterns (as understood by path.Match) matched
+// against Get paths. A pattern with a field name (e.g. "db/*#password") only matches
+// that field, while a pattern without one (e.g. "db/app") matches the whole document
+// and every field in it. Note that * does not match slashes.
+type pathPatterns []string
+
+func (p pathPatterns) match(getPath string) bool {
+	getPath = strings.TrimPrefix(getPath, "secret/")
+	doc, field, hasField := strings.Cut(getPath, "#")
+	for _, pattern := range p {
+		pattern = strings.TrimPrefix(pattern, "secret/")
+		patternDoc, patternField, patternHasField := strings.Cut(pattern, "#")
+		if ok, _ := path.Match(patternDoc, doc); !ok {
+			continue
+		}
+
+		if !patternHasField {
+			return true
+		}
+
+		if ok, _ := path.Match(patternField, field); ok && hasField {
+			return true
+		}
+	}
+
+	return false
+}
+
+// literal returns the patterns that do not use any glob syntax.
+func (p pathPatterns) literal() []string {
+	lits := []string{}
+	for _, pattern := range p {
+		if !strings.ContainsAny(pattern, `*?[\`) {
+			lits = append(lits, strings.TrimPrefix(pattern, "secret/"))
+		}
+	}
+
+	return lits
+}
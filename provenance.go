@@ -0,0 +1,45 @@
+package confy
+
+import (
+	"strconv"
+	"time"
+)
+
+// Sources a value can come from.
+const (
+	SourceVault       = "vault"
+	SourceEnvironment = "env"
+	SourceBundle      = "bundle"
+	SourceDefault     = "default"
+)
+
+// Provenance describes where a value came from.
+type Provenance struct {
+	// Source is one of the Source* constants, or the source named by a custom Backend.
+	Source string `json:"source"`
+	// Path is the path the value was read from, with its field if any.
+	Path string `json:"path"`
+	// Version is the KV v2 version of the document, or the version reported by its
+	// backend, such as the bundle version. It is empty when unknown.
+	Version string `json:"version,omitempty"`
+	// LoadedAt is when the document was last loaded. It is zero for values that
+	// did not come from a document.
+	LoadedAt time.Time `json:"loaded_at,omitempty"`
+}
+
+// provenance returns the provenance of values read from the document at docPath.
+func (d *documents) provenance(docPath, getPath string) Provenance {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	doc, ok := d.state[docPath]
+	if !ok {
+		return Provenance{Source: SourceVault, Path: getPath}
+	}
+
+	p := Provenance{Source: doc.source, Path: getPath, Version: doc.sourceVersion, LoadedAt: doc.loadedAt}
+	if p.Version == "" && doc.version > 0 {
+		p.Version = strconv.FormatInt(doc.version, 10)
+	}
+
+	return p
+}
@@ -0,0 +1,118 @@
+package confy
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxConfigLabelLength caps the length of the value label of confy_config_info.
+const maxConfigLabelLength = 128
+
+// WithNonSecretFields marks the fields matching the given patterns as safe to publish. With
+// WithMetrics, they are exported as the confy_config_info{path,field,value} metric, and
+// numeric values (numbers, booleans as 0 or 1, and durations in seconds, including strings
+// that parse as one) as confy_config_value{path,field}. Patterns use the syntax of
+// WithSecretFields, which takes precedence: a field marked as secret is never published.
+//
+// Values are published whenever their document is loaded. Literal patterns (without glob
+// characters) are also watched, so they stay current even if the application never reads them.
+func WithNonSecretFields(patterns ...string) Option {
+	return func(c *confyImpl) {
+		c.nonSecrets = append(c.nonSecrets, patterns...)
+	}
+}
+
+// configField is a non-secret field published as metrics.
+type configField struct {
+	field   string
+	value   string
+	numeric float64
+	// isNumeric is set when the value can be published as confy_config_value.
+	isNumeric bool
+}
+
+// publishConfig publishes the non-secret fields of the document at path.
+func (c *confyImpl) publishConfig(path string, data map[string]any) {
+	if c.metrics == nil || len(c.nonSecrets) == 0 || strings.HasPrefix(path, "/") {
+		return
+	}
+
+	fields := []configField{}
+	var walk func(prefix string, data map[string]any)
+	walk = func(prefix string, data map[string]any) {
+		for k, v := range data {
+			field := prefix + k
+			if nested, ok := v.(map[string]any); ok {
+				walk(field+".", nested)
+				continue
+			}
+			getPath := path + "#" + field
+			if !c.nonSecrets.match(getPath) || c.secrets.match(getPath) {
+				continue
+			}
+			if f, ok := newConfigField(field, v); ok {
+				fields = append(fields, f)
+			}
+		}
+	}
+	walk("", data)
+
+	c.metrics.config(path, fields)
+}
+
+func newConfigField(field string, v any) (configField, bool) {
+	f := configField{field: field}
+	switch val := v.(type) {
+	case nil, []any:
+		return f, false
+	case json.Number:
+		f.numeric, f.isNumeric = numberValue(val)
+	case bool:
+		f.isNumeric = true
+		if val {
+			f.numeric = 1
+		}
+	case string:
+		// KV v1 values written from the command line are always strings, so they are
+		// coerced like Value.Float64 and Value.Bool do.
+		if n, err := strconv.ParseFloat(val, 64); err == nil && !math.IsNaN(n) && !math.IsInf(n, 0) {
+			f.numeric, f.isNumeric = n, true
+		} else if b, err := strconv.ParseBool(val); err == nil {
+			f.isNumeric = true
+			if b {
+				f.numeric = 1
+			}
+		} else if d, err := time.ParseDuration(val); err == nil {
+			f.numeric, f.isNumeric = d.Seconds(), true
+		}
+	}
+
+	// Label values must be valid UTF-8, so values are cut on a rune boundary.
+	f.value = strings.ToValidUTF8(stringify(v), "\uFFFD")
+	if len(f.value) > maxConfigLabelLength {
+		n := maxConfigLabelLength
+		for n > 0 && !utf8.RuneStart(f.value[n]) {
+			n--
+		}
+		f.value = f.value[:n]
+	}
+
+	return f, true
+}
+
+func numberValue(n json.Number) (float64, bool) {
+	v, err := n.Float64()
+	return v, err == nil
+}
+
+// watchNonSecretFields keeps the documents of the literal non-secret patterns loaded, so
+// that their values are published as they change.
+func (c *confyImpl) watchNonSecretFields() {
+	for _, path := range c.nonSecrets.literal() {
+		c.watch(path, []string{documentPath(path)}, c.Get, func(_, _ Value) bool { return false }, nil)
+	}
+}
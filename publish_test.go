@@ -0,0 +1,91 @@
+package confy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNonSecretFieldMetrics(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"search/app": {
+			"pool":     map[string]any{"size": 10},
+			"debug":    true,
+			"timeout":  "1m30s",
+			"mode":     "fast",
+			"password": "hunter22",
+		},
+		"search/db": {"hosts": []any{"a"}, "user": "db-user"},
+	})
+	reg := prometheus.NewRegistry()
+	c := new(fake.client(t), 100*time.Millisecond, false,
+		WithMetrics(reg),
+		WithSecretFields("*/*#password"),
+		WithNonSecretFields("search/app", "search/*#user"),
+	)
+	defer c.Close()
+	m := newMetrics(reg)
+
+	// The literal pattern is watched, so its document is published without being read.
+	waitFor(t, func() bool { return testutil.CollectAndCount(m.configInfo) == 4 })
+	if v := testutil.ToFloat64(m.configInfo.WithLabelValues("search/app", "mode", "fast")); v != 1 {
+		t.Fatalf("expected the mode to be published")
+	}
+	for field, expected := range map[string]float64{"pool.size": 10, "debug": 1, "timeout": 90} {
+		if v := testutil.ToFloat64(m.configValues.WithLabelValues("search/app", field)); v != expected {
+			t.Fatalf("expected %s to be %v; got %v", field, expected, v)
+		}
+	}
+
+	// Glob patterns are published when their document is loaded.
+	if _, err := c.Get(context.Background(), "search/db#user"); err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	if v := testutil.ToFloat64(m.configInfo.WithLabelValues("search/db", "user", "db-user")); v != 1 {
+		t.Fatalf("expected the db user to be published")
+	}
+
+	fake.put("search/app", map[string]any{"mode": "slow", "password": "hunter22"})
+	waitFor(t, func() bool { return testutil.CollectAndCount(m.configInfo) == 2 })
+	if v := testutil.ToFloat64(m.configInfo.WithLabelValues("search/app", "mode", "slow")); v != 1 {
+		t.Fatalf("expected the new mode to be published")
+	}
+	if n := testutil.CollectAndCount(m.configValues); n != 0 {
+		t.Fatalf("expected the removed numeric fields to be unpublished; got %d", n)
+	}
+}
+
+func TestNonSecretFieldNumericStrings(t *testing.T) {
+	for value, expected := range map[string]float64{"10": 10, "2.5": 2.5, "true": 1, "false": 0, "1m": 60} {
+		f, ok := newConfigField("pool.size", value)
+		if !ok || !f.isNumeric || f.numeric != expected || f.value != value {
+			t.Fatalf("expected %q to be published as %v; got %+v", value, expected, f)
+		}
+	}
+	for _, value := range []string{"fast", "NaN", "Inf"} {
+		if f, _ := newConfigField("mode", value); f.isNumeric {
+			t.Fatalf("expected %q not to be numeric", value)
+		}
+	}
+}
+
+func TestNonSecretFieldMultibyteValue(t *testing.T) {
+	long := "a" + strings.Repeat("é", 100)
+	fake := newFakeVault(t, map[string]map[string]any{"app": {"motd": long}})
+	reg := prometheus.NewRegistry()
+	c := new(fake.client(t), time.Minute, false, WithMetrics(reg), WithNonSecretFields("app#motd"))
+	defer c.Close()
+
+	if _, err := c.Get(context.Background(), "app#motd"); err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	f, _ := newConfigField("motd", long)
+	if !utf8.ValidString(f.value) || len(f.value) > maxConfigLabelLength || !strings.HasPrefix(long, f.value) {
+		t.Fatalf("expected the value to be cut on a rune boundary; got %q", f.value)
+	}
+}
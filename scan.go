@@ -0,0 +1,268 @@
+package confy
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Kinds of findings reported by Scan.
+const (
+	FindingPlaceholder = "placeholder"
+	FindingLowEntropy  = "low_entropy"
+	FindingDuplicate   = "duplicate"
+	FindingStale       = "stale"
+)
+
+// DefaultMinEntropyBits is the estimated entropy below which Scan reports a secret as weak.
+const DefaultMinEntropyBits = 50
+
+// DefaultPlaceholders are the patterns (as understood by path.Match, compared in lower case)
+// of the values Scan reports as placeholders.
+var DefaultPlaceholders = []string{
+	"*changeme*", "*change-me*", "*change_me*", "*replaceme*", "*replace-me*",
+	"fake-*", "fake_*", "*placeholder*", "dummy*", "xxx*", "todo", "tbd",
+	"password", "secret", "123456*",
+}
+
+// secretFieldNames are the words that make Scan treat a field as a secret, when found in
+// the last part of its name.
+var secretFieldNames = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "private_key", "credential"}
+
+// ScanPolicy configures Scan. Its zero value uses the defaults.
+type ScanPolicy struct {
+	// Placeholders are patterns of placeholder values. DefaultPlaceholders is used when nil.
+	Placeholders []string
+	// MinEntropyBits is the estimated entropy secrets must have. DefaultMinEntropyBits is
+	// used when 0; a negative value disables the check.
+	MinEntropyBits float64
+	// KVv2Mount, when set, is the mount of a KV v2 engine (e.g. "kv") to scan instead of
+	// the KV v1 engine mounted at secret/.
+	KVv2Mount string
+	// MaxAge is how old the current version of a KV v2 document may be, based on its
+	// created_time, before it is reported as due for rotation. 0 disables the check. It
+	// only applies with KVv2Mount, since KV v1 keeps no such metadata.
+	MaxAge time.Duration
+}
+
+// Finding is an issue found by Scan. Values are always redacted: only a range of their
+// length is reported.
+type Finding struct {
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Field  string `json:"field,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// Scanner is implemented by the clients returned by New.
+type Scanner interface {
+	// Scan reads every document under prefix from Vault, and reports placeholder values,
+	// low entropy secrets, secrets reused across documents, and, with policy.KVv2Mount,
+	// documents whose current version is older than the policy allows. Fields are
+	// considered secrets when marked with WithSecretFields, or when their name mentions a
+	// password, secret, token, API key, private key or credential.
+	// Environment overrides and interceptors do not apply.
+	Scan(ctx context.Context, prefix string, policy ScanPolicy) ([]Finding, error)
+}
+
+// scannedSecret is a secret value seen by Scan, for duplicate detection.
+type scannedSecret struct {
+	path  string
+	field string
+	value string
+}
+
+func (c *confyImpl) Scan(ctx context.Context, prefix string, policy ScanPolicy) ([]Finding, error) {
+	if policy.Placeholders == nil {
+		policy.Placeholders = DefaultPlaceholders
+	}
+	if policy.MinEntropyBits == 0 {
+		policy.MinEntropyBits = DefaultMinEntropyBits
+	}
+
+	kv2 := strings.Trim(policy.KVv2Mount, "/")
+	var (
+		paths []string
+		err   error
+	)
+	if kv2 == "" {
+		paths, err = c.List(ctx, prefix)
+	} else if c.client == nil {
+		err = errNoVaultClient
+	} else {
+		paths, err = c.listMount(ctx, kv2+"/metadata", prefix)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []Finding{}
+	secrets := map[[sha256.Size]byte][]scannedSecret{}
+	for _, docPath := range paths {
+		var v Value
+		if kv2 == "" {
+			v, err = c.load(ctx, docPath, "")
+		} else {
+			v, err = c.Logical(ctx, kv2+"/data/"+docPath, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields, _ := v.Data()
+
+		// KV v2 reads return the fields under data, next to the metadata of the version.
+		if kv2 != "" {
+			meta, _ := fields["metadata"].(map[string]any)
+			fields, _ = fields["data"].(map[string]any)
+			if created, ok := parseTimestamp(meta["created_time"]); ok && policy.MaxAge > 0 && time.Since(created) > policy.MaxAge {
+				findings = append(findings, Finding{
+					Kind:   FindingStale,
+					Path:   docPath,
+					Detail: fmt.Sprintf("created %s ago, rotation policy is %s", time.Since(created).Round(time.Hour), policy.MaxAge),
+				})
+			}
+		}
+
+		walkStrings(fields, "", func(field, s string) {
+			if isPlaceholder(s, policy.Placeholders) {
+				findings = append(findings, Finding{Kind: FindingPlaceholder, Path: docPath, Field: field, Value: redact(s), Detail: "placeholder value"})
+				return
+			}
+			if !c.isSecretField(docPath, field) || s == "" {
+				return
+			}
+			if bits := entropyBits(s); policy.MinEntropyBits > 0 && bits < policy.MinEntropyBits {
+				findings = append(findings, Finding{
+					Kind:   FindingLowEntropy,
+					Path:   docPath,
+					Field:  field,
+					Value:  redact(s),
+					Detail: fmt.Sprintf("estimated entropy is %.0f bits, below %.0f", bits, policy.MinEntropyBits),
+				})
+			}
+			sum := sha256.Sum256([]byte(s))
+			secrets[sum] = append(secrets[sum], scannedSecret{path: docPath, field: field, value: s})
+		})
+	}
+
+	for _, seen := range secrets {
+		docs := map[string]bool{}
+		for _, s := range seen {
+			docs[s.path] = true
+		}
+		if len(docs) < 2 {
+			continue
+		}
+		for _, s := range seen {
+			others := []string{}
+			for _, o := range seen {
+				if o.path != s.path {
+					others = append(others, o.path+"#"+o.field)
+				}
+			}
+			sort.Strings(others)
+			findings = append(findings, Finding{
+				Kind:   FindingDuplicate,
+				Path:   s.path,
+				Field:  s.field,
+				Value:  redact(s.value),
+				Detail: "also used by " + strings.Join(others, ", "),
+			})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Path != findings[j].Path {
+			return findings[i].Path < findings[j].Path
+		}
+		if findings[i].Field != findings[j].Field {
+			return findings[i].Field < findings[j].Field
+		}
+		return findings[i].Kind < findings[j].Kind
+	})
+
+	return findings, nil
+}
+
+// walkStrings calls fn for every string in data, with its dotted field name.
+func walkStrings(data map[string]any, prefix string, fn func(field, s string)) {
+	for k, v := range data {
+		field := k
+		if prefix != "" {
+			field = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case string:
+			fn(field, v)
+		case map[string]any:
+			walkStrings(v, field, fn)
+		}
+	}
+}
+
+func (c *confyImpl) isSecretField(docPath, field string) bool {
+	if c.secrets.match(docPath + "#" + field) {
+		return true
+	}
+
+	name := strings.ToLower(field[strings.LastIndex(field, ".")+1:])
+	for _, word := range secretFieldNames {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isPlaceholder(s string, patterns []string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// entropyBits estimates the entropy of s from the frequency of its characters.
+func entropyBits(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+
+	perChar := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		perChar -= p * math.Log2(p)
+	}
+
+	return perChar * float64(n)
+}
+
+// redact hides s, only giving away a rough idea of its length. Findings point at weak
+// secrets, so no character of them, nor their exact length, is revealed.
+func redact(s string) string {
+	n := utf8.RuneCountInString(s)
+	switch {
+	case n < 8:
+		return "[redacted, under 8 chars]"
+	case n < 16:
+		return "[redacted, 8 to 15 chars]"
+	case n < 32:
+		return "[redacted, 16 to 31 chars]"
+	}
+
+	return "[redacted, 32 chars or more]"
+}
@@ -0,0 +1,98 @@
+package confy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"prod/app": {"user": "app", "password": "fake-password", "api_token": "Vq3#kP9x!Lm2@Zr7$Tn4"},
+		"prod/db":  {"db_password": "password123", "shared": map[string]any{"token": "Vq3#kP9x!Lm2@Zr7$Tn4"}},
+		"dev/app":  {"password": "changeme"},
+	})
+	c := new(fake.client(t), time.Minute, false)
+	defer c.Close()
+
+	findings, err := c.(Scanner).Scan(context.Background(), "prod/", ScanPolicy{MaxAge: 90 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+
+	got := []string{}
+	for _, f := range findings {
+		got = append(got, f.Kind+" "+f.Path+"#"+f.Field)
+		if strings.Contains(f.Value, "password") || strings.Contains(f.Value, "Vq3#") {
+			t.Fatalf("expected values to be redacted; got %+v", f)
+		}
+	}
+	expected := []string{
+		"duplicate prod/app#api_token",
+		"placeholder prod/app#password",
+		"low_entropy prod/db#db_password",
+		"duplicate prod/db#shared.token",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected findings:\n%s", strings.Join(got, "\n"))
+	}
+	if findings[0].Detail != "also used by prod/db#shared.token" {
+		t.Fatalf("expected duplicates to point at each other; got %q", findings[0].Detail)
+	}
+}
+
+func TestScanKVv2(t *testing.T) {
+	fake := newFakeVault(t, nil)
+	created := map[string]string{
+		"prod/old": time.Now().Add(-200 * 24 * time.Hour).Format(time.RFC3339Nano),
+		"prod/new": time.Now().Add(-time.Hour).Format(time.RFC3339Nano),
+	}
+	fake.handle("/v1/kv/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/kv/metadata/prod" && (r.Method == "LIST" || r.URL.Query().Get("list") == "true"):
+			writeJSON(w, map[string]any{"data": map[string]any{"keys": []string{"new", "old"}}})
+		case strings.HasPrefix(r.URL.Path, "/v1/kv/data/") && r.Method == http.MethodGet:
+			path := strings.TrimPrefix(r.URL.Path, "/v1/kv/data/")
+			writeJSON(w, map[string]any{"data": map[string]any{
+				"data":     map[string]any{"password": "changeme"},
+				"metadata": map[string]any{"created_time": created[path], "version": 3},
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	c := new(fake.client(t), time.Minute, false)
+	defer c.Close()
+
+	findings, err := c.(Scanner).Scan(context.Background(), "prod/", ScanPolicy{KVv2Mount: "kv", MaxAge: 90 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	got := []string{}
+	for _, f := range findings {
+		got = append(got, f.Kind+" "+f.Path+"#"+f.Field)
+	}
+	expected := []string{
+		"placeholder prod/new#password",
+		"stale prod/old#",
+		"placeholder prod/old#password",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected findings:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestRedact(t *testing.T) {
+	for s, expected := range map[string]string{
+		"short":                 "[redacted, under 8 chars]",
+		"password123":           "[redacted, 8 to 15 chars]",
+		"Vq3#kP9x!Lm2@Zr7$Tn4":  "[redacted, 16 to 31 chars]",
+		strings.Repeat("é", 40): "[redacted, 32 chars or more]",
+	} {
+		if r := redact(s); r != expected {
+			t.Fatalf("expected %q to be redacted as %q; got %q", s, expected, r)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package confy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+)
+
+// WithLatencyBudget lets Get return the last known version of a document, marked stale
+// (see Value.IsStale), rather than block on Vault once its cache entry has expired. The
+// document is refreshed in the background either way, and later reads get the new version.
+//
+// The stale version is returned right away if the context of the read has less than
+// deadlineThreshold left before its deadline, and otherwise once the refresh has taken
+// longer than budget. Either can be 0 to disable it. Documents that were never loaded
+// are always read synchronously.
+func WithLatencyBudget(budget, deadlineThreshold time.Duration) Option {
+	return func(c *confyImpl) {
+		c.stale.budget = budget
+		c.stale.deadlineThreshold = deadlineThreshold
+	}
+}
+
+// staleReads keeps the last known version of every document, and the refreshes that
+// run in the background for reads that did not wait for them.
+type staleReads struct {
+	budget            time.Duration
+	deadlineThreshold time.Duration
+
+	mu        sync.Mutex
+	last      map[string]loadedDocument
+	refreshes map[string]*refresh
+}
+
+type refresh struct {
+	done chan struct{}
+	item *ttlcache.Item[string, loadedDocument]
+	err  error
+}
+
+func (s *staleReads) enabled() bool {
+	return s.budget > 0 || s.deadlineThreshold > 0
+}
+
+// remember records the latest version of the document cached under key.
+func (s *staleReads) remember(key string, doc loadedDocument) {
+	if !s.enabled() {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil {
+		s.last = map[string]loadedDocument{}
+	}
+	s.last[key] = doc
+}
+
+func (s *staleReads) lastKnown(key string) (loadedDocument, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, ok := s.last[key]
+	return doc, ok
+}
+
+// loadDocument returns the document cached under key, loading it if needed, or from the
+// snapshot if the client is frozen. The boolean return value is true if the last known
+// version was returned instead of waiting for the document to load (see WithLatencyBudget).
+func (c *confyImpl) loadDocument(ctx context.Context, key string) (loadedDocument, bool, error) {
+	if doc, frozen, err := c.frozenDocument(key); frozen {
+		return doc, false, err
+	}
+	if c.stale.enabled() {
+		if item := c.cache.Get(key); item != nil {
+			return item.Value(), false, nil
+		}
+		if last, ok := c.stale.lastKnown(key); ok {
+			return c.loadWithinBudget(ctx, key, last)
+		}
+	}
+
+	var errBucket error
+	item := c.cache.Get(key, ttlcache.WithLoader(c.createLoader(ctx, &errBucket)))
+	if item == nil {
+		if errBucket != nil {
+			return loadedDocument{}, false, errBucket
+		}
+		return loadedDocument{}, false, errors.New("no value found")
+	}
+
+	return item.Value(), false, nil
+}
+
+// loadWithinBudget refreshes the document cached under key in the background, and waits
+// for it as long as the latency budget and the deadline of ctx allow. Otherwise, it
+// returns last, the last known version of the document.
+func (c *confyImpl) loadWithinBudget(ctx context.Context, key string, last loadedDocument) (loadedDocument, bool, error) {
+	r := c.refresh(key)
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < c.stale.deadlineThreshold {
+		return last, true, nil
+	}
+	var budget <-chan time.Time
+	if c.stale.budget > 0 {
+		timer := time.NewTimer(c.stale.budget)
+		defer timer.Stop()
+		budget = timer.C
+	}
+
+	select {
+	case <-r.done:
+		if r.item == nil {
+			return loadedDocument{}, false, r.err
+		}
+		return r.item.Value(), false, nil
+	case <-budget:
+	case <-ctx.Done():
+	}
+	c.logger.Debug("confy returned a stale document", map[string]any{"path": key})
+
+	return last, true, nil
+}
+
+// refresh starts loading the document cached under key in the background, unless it is
+// already being loaded. The load is not bound to the context of any read, so that it can
+// finish after the reads that started it returned, but it is canceled by Close.
+func (c *confyImpl) refresh(key string) *refresh {
+	c.stale.mu.Lock()
+	defer c.stale.mu.Unlock()
+	if r, ok := c.stale.refreshes[key]; ok {
+		return r
+	}
+	if c.stale.refreshes == nil {
+		c.stale.refreshes = map[string]*refresh{}
+	}
+
+	r := &refresh{done: make(chan struct{})}
+	c.stale.refreshes[key] = r
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-c.done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		r.item = c.cache.Get(key, ttlcache.WithLoader(c.createLoader(ctx, &r.err)))
+		if r.item == nil && r.err == nil {
+			r.err = errors.New("no value found")
+		}
+		if r.err != nil {
+			c.logger.Warn("confy could not refresh document in the background", map[string]any{"path": key, "err": r.err})
+		}
+
+		c.stale.mu.Lock()
+		delete(c.stale.refreshes, key)
+		c.stale.mu.Unlock()
+		close(r.done)
+	}()
+
+	return r
+}
@@ -0,0 +1,114 @@
+package confy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLatencyBudget(t *testing.T) {
+	fake := newFakeVault(t, nil)
+	var mu sync.Mutex
+	user := "a"
+	release := make(chan struct{})
+	slow := false
+	fake.handle("/v1/secret/app", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		wait := slow
+		u := user
+		mu.Unlock()
+		if wait {
+			<-release
+		}
+		writeJSON(w, map[string]any{"data": map[string]any{"user": u}})
+	}))
+	c := new(fake.client(t), time.Minute, false, WithLatencyBudget(50*time.Millisecond, time.Second)).(*confyImpl)
+	defer c.Close()
+	ctx := context.Background()
+
+	v, err := c.Get(ctx, "app#user")
+	if err != nil || v.String() != "a" || v.IsStale() {
+		t.Fatalf("unexpected value: %v, %v", v, err)
+	}
+
+	// Vault is slow, so the last known value is returned once the budget is spent.
+	mu.Lock()
+	slow, user = true, "b"
+	mu.Unlock()
+	c.cache.Delete("app")
+	start := time.Now()
+	v, err = c.Get(ctx, "app#user")
+	if err != nil || v.String() != "a" || !v.IsStale() {
+		t.Fatalf("expected a stale value; got %v, %v", v, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the read to take about the budget; took %s", elapsed)
+	}
+
+	// Reads close to their deadline do not wait at all.
+	deadline, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if v, err := c.Get(deadline, "app#user"); err != nil || !v.IsStale() || time.Since(start) > 40*time.Millisecond {
+		t.Fatalf("expected a stale value right away; got %v, %v after %s", v, err, time.Since(start))
+	}
+
+	// The refresh finishes in the background.
+	mu.Lock()
+	slow = false
+	mu.Unlock()
+	close(release)
+	waitFor(t, func() bool {
+		v, err := c.Get(ctx, "app#user")
+		return err == nil && v.String() == "b" && !v.IsStale()
+	})
+}
+
+func TestStaleValuesKeepTheirGeneration(t *testing.T) {
+	fake := newFakeVault(t, nil)
+	var mu sync.Mutex
+	user := "a"
+	release := make(chan struct{})
+	fake.handle("/v1/secret/app", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		u := user
+		mu.Unlock()
+		if u != "a" {
+			<-release
+		}
+		writeJSON(w, map[string]any{"data": map[string]any{"user": u}})
+	}))
+	c := new(fake.client(t), time.Minute, false, WithLatencyBudget(10*time.Millisecond, 0)).(*confyImpl)
+	defer c.Close()
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "app#user"); err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	mu.Lock()
+	user = "b"
+	mu.Unlock()
+	c.cache.Delete("app")
+	if v, err := c.Get(ctx, "app#user"); err != nil || !v.IsStale() {
+		t.Fatalf("expected a stale value; got %v, %v", v, err)
+	}
+
+	// The snapshot is taken before the refresh lands, so frozen reads must keep reporting
+	// the generation of the snapshot rather than the current one.
+	c.Freeze()
+	close(release)
+	waitFor(t, func() bool {
+		doc, _ := c.docs.current("app")
+		return doc.generation == 2
+	})
+
+	v, err := c.Get(ctx, "app#user")
+	if err != nil || v.String() != "a" {
+		t.Fatalf("expected the frozen value; got %v, %v", v, err)
+	}
+	if g := v.(*value).origin.generation; g != 1 {
+		t.Fatalf("expected the value to come with the generation of its content; got %d", g)
+	}
+}
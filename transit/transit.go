@@ -0,0 +1,312 @@
+// Package transit provides helpers for Vault's Transit secrets engine on top of a confy
+// client: encryption, decryption, rewrapping, signing and verification, with batch
+// variants, and data key generation for envelope encryption.
+//
+// Every request goes through the client's Logical method, so it is sent with the client's
+// Vault login and reported by its metrics like any other request.
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/renier/confy"
+)
+
+const (
+	DefaultMount      = "transit"
+	DefaultDataKeyTTL = 5 * time.Minute
+)
+
+// Client sends requests to a Transit engine.
+type Client struct {
+	logical    confy.LogicalClient
+	mount      string
+	dataKeyTTL time.Duration
+	dataKeys   *ttlcache.Cache[dataKeyID, []byte]
+	// stopWiping unsubscribes from the evictions of dataKeys, once the wipes under way are done.
+	stopWiping func()
+	closeOnce  sync.Once
+}
+
+// Option customizes the client returned by New.
+type Option func(t *Client)
+
+// WithMount sets the path the Transit engine is mounted at. It is DefaultMount by default.
+func WithMount(mount string) Option {
+	return func(t *Client) {
+		t.mount = mount
+	}
+}
+
+// WithDataKeyTTL sets how long plaintext data keys are kept in memory after they are
+// generated or decrypted. It is DefaultDataKeyTTL by default; 0 disables the cache.
+func WithDataKeyTTL(ttl time.Duration) Option {
+	return func(t *Client) {
+		t.dataKeyTTL = ttl
+	}
+}
+
+// New returns a Transit client that sends its requests through c, usually the client
+// returned by confy.New. Call Close once done with it, to wipe the cached data keys.
+func New(c confy.LogicalClient, opts ...Option) *Client {
+	t := &Client{logical: c, mount: DefaultMount, dataKeyTTL: DefaultDataKeyTTL}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	t.dataKeys = ttlcache.New(
+		ttlcache.WithTTL[dataKeyID, []byte](t.dataKeyTTL),
+		ttlcache.WithDisableTouchOnHit[dataKeyID, []byte](),
+	)
+	// Wipe plaintext keys from memory once they are evicted. Callers get copies.
+	t.stopWiping = t.dataKeys.OnEviction(func(_ context.Context, _ ttlcache.EvictionReason, item *ttlcache.Item[dataKeyID, []byte]) {
+		key := item.Value()
+		for i := range key {
+			key[i] = 0
+		}
+	})
+	if t.dataKeyTTL > 0 {
+		go t.dataKeys.Start()
+	}
+
+	return t
+}
+
+// Result is the outcome of one item of a batch request. Err is set if Vault rejected the
+// item; the other items of the batch are not affected.
+type Result struct {
+	Ciphertext string
+	Plaintext  []byte
+	Err        error
+}
+
+// Encrypt encrypts plaintext with the named key. It returns Vault's ciphertext, such
+// as "vault:v1:...".
+func (t *Client) Encrypt(ctx context.Context, key string, plaintext []byte) (string, error) {
+	v, err := t.write(ctx, "encrypt/"+key, map[string]any{"plaintext": base64.StdEncoding.EncodeToString(plaintext)})
+	if err != nil {
+		return "", err
+	}
+
+	return stringField(v, "ciphertext")
+}
+
+// EncryptBatch encrypts every plaintext with the named key in a single request. Results
+// are in the same order as plaintexts.
+func (t *Client) EncryptBatch(ctx context.Context, key string, plaintexts [][]byte) ([]Result, error) {
+	items := make([]map[string]any, len(plaintexts))
+	for i, p := range plaintexts {
+		items[i] = map[string]any{"plaintext": base64.StdEncoding.EncodeToString(p)}
+	}
+
+	return t.batch(ctx, "encrypt/"+key, items)
+}
+
+// Decrypt decrypts a ciphertext produced by Encrypt with the named key.
+func (t *Client) Decrypt(ctx context.Context, key, ciphertext string) ([]byte, error) {
+	v, err := t.write(ctx, "decrypt/"+key, map[string]any{"ciphertext": ciphertext})
+	if err != nil {
+		return nil, err
+	}
+
+	return plaintextField(v)
+}
+
+// DecryptBatch decrypts every ciphertext with the named key in a single request.
+func (t *Client) DecryptBatch(ctx context.Context, key string, ciphertexts []string) ([]Result, error) {
+	return t.batch(ctx, "decrypt/"+key, ciphertextItems(ciphertexts))
+}
+
+// Rewrap re-encrypts ciphertext with the latest version of the named key, without
+// revealing the plaintext.
+func (t *Client) Rewrap(ctx context.Context, key, ciphertext string) (string, error) {
+	v, err := t.write(ctx, "rewrap/"+key, map[string]any{"ciphertext": ciphertext})
+	if err != nil {
+		return "", err
+	}
+
+	return stringField(v, "ciphertext")
+}
+
+// RewrapBatch rewraps every ciphertext with the named key in a single request.
+func (t *Client) RewrapBatch(ctx context.Context, key string, ciphertexts []string) ([]Result, error) {
+	return t.batch(ctx, "rewrap/"+key, ciphertextItems(ciphertexts))
+}
+
+// Sign signs input with the named key, using the engine's default hash and signature
+// algorithms. It returns Vault's signature, such as "vault:v1:...".
+func (t *Client) Sign(ctx context.Context, key string, input []byte) (string, error) {
+	v, err := t.write(ctx, "sign/"+key, map[string]any{"input": base64.StdEncoding.EncodeToString(input)})
+	if err != nil {
+		return "", err
+	}
+
+	return stringField(v, "signature")
+}
+
+// Verify reports whether signature, produced by Sign, is valid for input.
+func (t *Client) Verify(ctx context.Context, key string, input []byte, signature string) (bool, error) {
+	v, err := t.write(ctx, "verify/"+key, map[string]any{
+		"input":     base64.StdEncoding.EncodeToString(input),
+		"signature": signature,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	data, _ := v.Data()
+	valid, ok := data["valid"].(bool)
+	if !ok {
+		return false, errors.New("vault returned no verification result")
+	}
+
+	return valid, nil
+}
+
+// DataKey is a data key for envelope encryption. Ciphertext is the key encrypted by
+// Vault, to be stored next to the data; Plaintext is used locally and must not be stored.
+type DataKey struct {
+	Plaintext  []byte
+	Ciphertext string
+}
+
+type dataKeyID struct {
+	key        string
+	ciphertext string
+}
+
+// GenerateDataKey generates a new 256-bit data key, encrypted with the named key.
+// The plaintext key is cached, so DecryptDataKey does not need to go to Vault for it.
+func (t *Client) GenerateDataKey(ctx context.Context, key string) (*DataKey, error) {
+	v, err := t.write(ctx, "datakey/plaintext/"+key, map[string]any{})
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := v.Data()
+	ciphertext, _ := data["ciphertext"].(string)
+	encoded, _ := data["plaintext"].(string)
+	plaintext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || ciphertext == "" || len(plaintext) == 0 {
+		return nil, errors.New("vault returned an invalid data key")
+	}
+	t.cacheDataKey(key, ciphertext, plaintext)
+
+	return &DataKey{Plaintext: plaintext, Ciphertext: ciphertext}, nil
+}
+
+// DecryptDataKey returns the plaintext of a data key generated by GenerateDataKey. It is
+// served from the local cache when possible, and cached otherwise.
+func (t *Client) DecryptDataKey(ctx context.Context, key, ciphertext string) ([]byte, error) {
+	if item := t.dataKeys.Get(dataKeyID{key: key, ciphertext: ciphertext}); item != nil {
+		return append([]byte(nil), item.Value()...), nil
+	}
+
+	plaintext, err := t.Decrypt(ctx, key, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	t.cacheDataKey(key, ciphertext, plaintext)
+
+	return plaintext, nil
+}
+
+func (t *Client) cacheDataKey(key, ciphertext string, plaintext []byte) {
+	if t.dataKeyTTL > 0 {
+		t.dataKeys.Set(dataKeyID{key: key, ciphertext: ciphertext}, append([]byte(nil), plaintext...), ttlcache.DefaultTTL)
+	}
+}
+
+// ClearDataKeys wipes every cached plaintext data key.
+func (t *Client) ClearDataKeys() {
+	t.dataKeys.DeleteAll()
+}
+
+// Close stops the expiration of cached data keys and wipes them, waiting for the wipes
+// to finish. Data keys must not be generated or decrypted through the client afterwards.
+func (t *Client) Close() {
+	t.closeOnce.Do(func() {
+		if t.dataKeyTTL > 0 {
+			t.dataKeys.Stop()
+		}
+		t.dataKeys.DeleteAll()
+		t.stopWiping()
+	})
+}
+
+func (t *Client) write(ctx context.Context, path string, data map[string]any) (confy.Value, error) {
+	v, err := t.logical.Logical(ctx, t.mount+"/"+path, &confy.LogicalOptions{Write: true, Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("transit request failed: %w", err)
+	}
+
+	return v, nil
+}
+
+// batch sends items as a batch request, and matches the results with them.
+func (t *Client) batch(ctx context.Context, path string, items []map[string]any) ([]Result, error) {
+	if len(items) == 0 {
+		return []Result{}, nil
+	}
+
+	v, err := t.write(ctx, path, map[string]any{"batch_input": items})
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := v.Data()
+	raw, _ := data["batch_results"].([]any)
+	if len(raw) != len(items) {
+		return nil, fmt.Errorf("vault returned %d batch results for %d items", len(raw), len(items))
+	}
+
+	results := make([]Result, len(raw))
+	for i, r := range raw {
+		item, _ := r.(map[string]any)
+		if msg, _ := item["error"].(string); msg != "" {
+			results[i].Err = errors.New(msg)
+			continue
+		}
+		results[i].Ciphertext, _ = item["ciphertext"].(string)
+		if encoded, ok := item["plaintext"].(string); ok {
+			results[i].Plaintext, results[i].Err = base64.StdEncoding.DecodeString(encoded)
+		}
+	}
+
+	return results, nil
+}
+
+func ciphertextItems(ciphertexts []string) []map[string]any {
+	items := make([]map[string]any, len(ciphertexts))
+	for i, c := range ciphertexts {
+		items[i] = map[string]any{"ciphertext": c}
+	}
+
+	return items
+}
+
+func stringField(v confy.Value, field string) (string, error) {
+	data, _ := v.Data()
+	s, _ := data[field].(string)
+	if s == "" {
+		return "", fmt.Errorf("vault returned no %s", field)
+	}
+
+	return s, nil
+}
+
+func plaintextField(v confy.Value) ([]byte, error) {
+	data, _ := v.Data()
+	encoded, ok := data["plaintext"].(string)
+	if !ok {
+		return nil, errors.New("vault returned no plaintext")
+	}
+
+	return base64.StdEncoding.DecodeString(encoded)
+}
@@ -0,0 +1,203 @@
+package transit
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bank-vaults/vault-sdk/vault"
+	"github.com/renier/confy"
+)
+
+// fakeTransit mimics the Transit engine by "encrypting" with a fixed prefix.
+type fakeTransit struct {
+	mu       sync.Mutex
+	decrypts int
+}
+
+func (f *fakeTransit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	op := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/transit/"), "/")[0]
+
+	f.mu.Lock()
+	if op == "decrypt" {
+		f.decrypts++
+	}
+	f.mu.Unlock()
+
+	apply := func(item map[string]any) map[string]any {
+		switch op {
+		case "encrypt":
+			return map[string]any{"ciphertext": "vault:v1:" + item["plaintext"].(string)}
+		case "decrypt":
+			c := item["ciphertext"].(string)
+			if !strings.HasPrefix(c, "vault:v1:") {
+				return map[string]any{"error": "invalid ciphertext"}
+			}
+			return map[string]any{"plaintext": strings.TrimPrefix(c, "vault:v1:")}
+		case "rewrap":
+			return map[string]any{"ciphertext": strings.Replace(item["ciphertext"].(string), "v1", "v2", 1)}
+		case "sign":
+			return map[string]any{"signature": "vault:v1:sig-" + item["input"].(string)}
+		case "verify":
+			return map[string]any{"valid": item["signature"] == "vault:v1:sig-"+item["input"].(string)}
+		case "datakey":
+			key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+			return map[string]any{"plaintext": key, "ciphertext": "vault:v1:" + key}
+		}
+		return nil
+	}
+
+	data := map[string]any{}
+	if batch, ok := body["batch_input"].([]any); ok {
+		results := []any{}
+		for _, item := range batch {
+			results = append(results, apply(item.(map[string]any)))
+		}
+		data["batch_results"] = results
+	} else {
+		data = apply(body)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func newTestClient(t *testing.T, opts ...Option) (*Client, *fakeTransit) {
+	t.Helper()
+	fake := &fakeTransit{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	t.Setenv("VAULT_ADDR", server.URL)
+	client, err := vault.NewClientWithOptions(vault.ClientToken("fake-token"))
+	if err != nil {
+		t.Fatalf("could not create vault client: %s", err)
+	}
+	c := confy.New(client, time.Minute, false)
+	t.Cleanup(c.Close)
+
+	return New(c.(confy.LogicalClient), opts...), fake
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	tr, _ := newTestClient(t)
+	ctx := context.Background()
+
+	ciphertext, err := tr.Encrypt(ctx, "app", []byte("hello"))
+	if err != nil || !strings.HasPrefix(ciphertext, "vault:v1:") {
+		t.Fatalf("unexpected ciphertext %q: %v", ciphertext, err)
+	}
+	plaintext, err := tr.Decrypt(ctx, "app", ciphertext)
+	if err != nil || string(plaintext) != "hello" {
+		t.Fatalf("unexpected plaintext %q: %v", plaintext, err)
+	}
+
+	rewrapped, err := tr.Rewrap(ctx, "app", ciphertext)
+	if err != nil || !strings.HasPrefix(rewrapped, "vault:v2:") {
+		t.Fatalf("unexpected rewrapped ciphertext %q: %v", rewrapped, err)
+	}
+
+	signature, err := tr.Sign(ctx, "app", []byte("msg"))
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	if valid, err := tr.Verify(ctx, "app", []byte("msg"), signature); err != nil || !valid {
+		t.Fatalf("expected the signature to be valid; got %v, %v", valid, err)
+	}
+	if valid, err := tr.Verify(ctx, "app", []byte("other"), signature); err != nil || valid {
+		t.Fatalf("expected the signature to be invalid; got %v, %v", valid, err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	tr, _ := newTestClient(t)
+	ctx := context.Background()
+
+	encrypted, err := tr.EncryptBatch(ctx, "app", [][]byte{[]byte("a"), []byte("b")})
+	if err != nil || len(encrypted) != 2 {
+		t.Fatalf("unexpected results %+v: %v", encrypted, err)
+	}
+
+	decrypted, err := tr.DecryptBatch(ctx, "app", []string{encrypted[1].Ciphertext, "garbage", encrypted[0].Ciphertext})
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+	if string(decrypted[0].Plaintext) != "b" || string(decrypted[2].Plaintext) != "a" {
+		t.Fatalf("expected results in the order of the input; got %+v", decrypted)
+	}
+	if decrypted[1].Err == nil {
+		t.Fatalf("expected an error for the invalid item")
+	}
+}
+
+func TestDataKeys(t *testing.T) {
+	tr, fake := newTestClient(t, WithDataKeyTTL(time.Hour))
+	ctx := context.Background()
+
+	dk, err := tr.GenerateDataKey(ctx, "app")
+	if err != nil || len(dk.Plaintext) != 32 {
+		t.Fatalf("unexpected data key %+v: %v", dk, err)
+	}
+
+	plaintext, err := tr.DecryptDataKey(ctx, "app", dk.Ciphertext)
+	if err != nil || !bytes.Equal(plaintext, dk.Plaintext) || fake.decrypts != 0 {
+		t.Fatalf("expected the data key from the cache; got %v, %v, %d decrypts", plaintext, err, fake.decrypts)
+	}
+
+	tr.ClearDataKeys()
+	plaintext, err = tr.DecryptDataKey(ctx, "app", dk.Ciphertext)
+	if err != nil || !bytes.Equal(plaintext, dk.Plaintext) || fake.decrypts != 1 {
+		t.Fatalf("expected the data key to be decrypted by Vault; got %v, %v, %d decrypts", plaintext, err, fake.decrypts)
+	}
+}
+
+func TestDataKeysAreWiped(t *testing.T) {
+	ctx := context.Background()
+	wiped := func(b []byte) bool { return bytes.Count(b, []byte{0}) == len(b) }
+
+	t.Run("on expiry", func(t *testing.T) {
+		tr, _ := newTestClient(t, WithDataKeyTTL(50*time.Millisecond))
+		defer tr.Close()
+		dk, err := tr.GenerateDataKey(ctx, "app")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		cached := tr.dataKeys.Get(dataKeyID{key: "app", ciphertext: dk.Ciphertext}).Value()
+
+		// The client is left idle: the key is wiped without any other call.
+		deadline := time.Now().Add(5 * time.Second)
+		for !wiped(cached) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the expired data key to be wiped")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if wiped(dk.Plaintext) {
+			t.Fatalf("expected the caller's copy to be left alone")
+		}
+	})
+
+	t.Run("on close", func(t *testing.T) {
+		tr, _ := newTestClient(t, WithDataKeyTTL(time.Hour))
+		dk, err := tr.GenerateDataKey(ctx, "app")
+		if err != nil {
+			t.Fatalf("did not expect an error: %s", err)
+		}
+		cached := tr.dataKeys.Get(dataKeyID{key: "app", ciphertext: dk.Ciphertext}).Value()
+
+		tr.Close()
+		tr.Close()
+		if !wiped(cached) {
+			t.Fatalf("expected the data key to be wiped by Close")
+		}
+	})
+}
@@ -0,0 +1,246 @@
+package confy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+)
+
+// ErrValidationFailed is reported (wrapped in a *ValidationError) when a document does not
+// satisfy a validation rule.
+var ErrValidationFailed = errors.New("validation failed")
+
+// ValidationRule is a CEL expression that one or more documents must satisfy. It is
+// evaluated every time one of its documents is loaded, including when a watch polls it:
+//
+//	confy.ValidationRule{
+//		Name:       "tls-cert",
+//		Documents:  map[string]string{"app": "search/prod/app"},
+//		Expression: "!has(app.tls) || !app.tls.enabled || has(app.tls.cert_path)",
+//		Message:    "tls.enabled requires tls.cert_path",
+//	}
+type ValidationRule struct {
+	Name string
+	// Documents binds the variables of the expression to the paths of documents, without
+	// the secret/ prefix. Documents that do not exist are bound to an empty map.
+	Documents map[string]string
+	// Expression is a CEL expression that must evaluate to true.
+	Expression string
+	// Message describes a violation of the rule.
+	Message string
+}
+
+// ValidationError is returned and reported to the error handler when a loaded document
+// violates a validation rule.
+type ValidationError struct {
+	// Path is the document whose update was rejected.
+	Path string
+	Rule string
+	// Message is the message of the rule.
+	Message string
+	// Err is set when the rule could not be evaluated.
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	msg := e.Message
+	if e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if msg == "" {
+		return fmt.Sprintf("document '%s' failed validation rule '%s'", e.Path, e.Rule)
+	}
+	return fmt.Sprintf("document '%s' failed validation rule '%s': %s", e.Path, e.Rule, msg)
+}
+
+func (e *ValidationError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{ErrValidationFailed, e.Err}
+	}
+	return []error{ErrValidationFailed}
+}
+
+// WithValidationRules sets rules that loaded documents must satisfy. A document that
+// violates a rule is not served: the client keeps serving the last version of it that
+// passed (so watches do not fire), and reports a *ValidationError to the error handler.
+// If no version of the document ever passed, Get returns the error.
+//
+// Rules over several documents are evaluated with the last version of the other documents
+// that passed validation, or their current version if they were never loaded. Rules that
+// do not compile fail every load of their documents.
+func WithValidationRules(rules ...ValidationRule) Option {
+	return func(c *confyImpl) {
+		c.validation.rules = append(c.validation.rules, rules...)
+	}
+}
+
+type validator struct {
+	rules    []ValidationRule
+	programs []validationProgram
+
+	mu   sync.Mutex
+	good map[string]map[string]any
+}
+
+type validationProgram struct {
+	rule    ValidationRule
+	program cel.Program
+	err     error
+}
+
+// compile compiles the rules, reporting the ones that do not compile.
+func (v *validator) compile(c *confyImpl) {
+	v.good = map[string]map[string]any{}
+	for _, rule := range v.rules {
+		docs := make(map[string]string, len(rule.Documents))
+		for name, path := range rule.Documents {
+			docs[name] = strings.Trim(strings.TrimPrefix(path, "secret/"), "/")
+		}
+		rule.Documents = docs
+
+		p := validationProgram{rule: rule}
+		p.program, p.err = compileRule(rule)
+		if p.err != nil {
+			c.reportError(fmt.Errorf("could not compile validation rule '%s': %w", rule.Name, p.err), nil)
+		}
+		v.programs = append(v.programs, p)
+	}
+}
+
+func compileRule(rule ValidationRule) (cel.Program, error) {
+	opts := make([]cel.EnvOption, 0, len(rule.Documents))
+	for name := range rule.Documents {
+		opts = append(opts, cel.Variable(name, cel.DynType))
+	}
+	env, err := cel.NewEnv(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ast, iss := env.Compile(rule.Expression)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("expression must evaluate to a bool, not %s", ast.OutputType())
+	}
+
+	return env.Program(ast)
+}
+
+// validate checks data, the new content of the document at path, against every rule
+// over that document.
+func (c *confyImpl) validate(ctx context.Context, path string, data map[string]any) error {
+	v := &c.validation
+	validated := false
+	for _, p := range v.programs {
+		if !p.uses(path) {
+			continue
+		}
+		validated = true
+
+		if p.err != nil {
+			return &ValidationError{Path: path, Rule: p.rule.Name, Message: p.rule.Message, Err: p.err}
+		}
+
+		vars := make(map[string]any, len(p.rule.Documents))
+		for name, docPath := range p.rule.Documents {
+			doc, err := c.validationInput(ctx, path, data, docPath)
+			if err != nil {
+				return &ValidationError{Path: path, Rule: p.rule.Name, Message: p.rule.Message, Err: err}
+			}
+			vars[name] = doc
+		}
+
+		out, _, err := p.program.ContextEval(ctx, vars)
+		if err != nil {
+			return &ValidationError{Path: path, Rule: p.rule.Name, Message: p.rule.Message, Err: err}
+		}
+		if ok, _ := out.Value().(bool); !ok {
+			return &ValidationError{Path: path, Rule: p.rule.Name, Message: p.rule.Message}
+		}
+	}
+
+	if validated {
+		v.mu.Lock()
+		v.good[path] = data
+		v.mu.Unlock()
+	}
+
+	return nil
+}
+
+// lastGood returns the last content of the document at path that passed validation.
+func (v *validator) lastGood(path string) (map[string]any, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	data, ok := v.good[path]
+	return data, ok
+}
+
+// validationInput returns the content of the document at docPath to evaluate a rule with,
+// converted to types CEL understands.
+func (c *confyImpl) validationInput(ctx context.Context, path string, data map[string]any, docPath string) (any, error) {
+	if docPath == path {
+		return celValue(data), nil
+	}
+	if good, ok := c.validation.lastGood(docPath); ok {
+		return celValue(good), nil
+	}
+
+	// The document was never loaded, so read it without caching it: it will be validated
+	// on its own when it is loaded.
+	resp, err := c.read(ctx, docPath)
+	if errors.Is(err, ErrNotFound) {
+		return map[string]any{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	other, err := decodeFields(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return celValue(other), nil
+}
+
+func (p *validationProgram) uses(path string) bool {
+	for _, docPath := range p.rule.Documents {
+		if docPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// celValue converts the JSON numbers in v to int64 or float64, which CEL can compare.
+func celValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = celValue(e)
+		}
+		return m
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = celValue(e)
+		}
+		return l
+	default:
+		return v
+	}
+}
@@ -0,0 +1,101 @@
+package confy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidationRules(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{
+		"search/db":  {"min_conns": 5, "max_conns": 10},
+		"search/app": {"pool": 8, "tls": map[string]any{"enabled": true, "cert_path": "/tls/cert.pem"}},
+		"search/bad": {"min_conns": 20, "max_conns": 10},
+	})
+	errs := make(chan error, 10)
+	c := new(fake.client(t), time.Minute, false,
+		WithErrorHandler(func(err error) { errs <- err }),
+		WithValidationRules(
+			ValidationRule{
+				Name:       "conns",
+				Documents:  map[string]string{"db": "secret/search/db"},
+				Expression: "db.min_conns <= db.max_conns",
+				Message:    "min_conns must not exceed max_conns",
+			},
+			ValidationRule{
+				Name:       "bad-conns",
+				Documents:  map[string]string{"db": "search/bad"},
+				Expression: "db.min_conns <= db.max_conns",
+			},
+			ValidationRule{
+				Name:       "pool",
+				Documents:  map[string]string{"app": "search/app", "db": "search/db"},
+				Expression: "app.pool <= db.max_conns && (!app.tls.enabled || has(app.tls.cert_path))",
+			},
+		),
+	).(*confyImpl)
+	defer c.Close()
+	ctx := context.Background()
+
+	if v, err := c.Get(ctx, "search/app#pool"); err != nil || v.String() != "8" {
+		t.Fatalf("unexpected value: %v, %v", v, err)
+	}
+	if v, err := c.Get(ctx, "search/db#max_conns"); err != nil || v.String() != "10" {
+		t.Fatalf("unexpected value: %v, %v", v, err)
+	}
+
+	// A document that never passed validation is not served.
+	var verr *ValidationError
+	if _, err := c.Get(ctx, "search/bad#min_conns"); !errors.As(err, &verr) || !errors.Is(err, ErrValidationFailed) || verr.Rule != "bad-conns" {
+		t.Fatalf("expected a validation error; got %v", err)
+	}
+	<-errs
+
+	// An update that violates a rule is reported, and the last good version is kept.
+	fake.put("search/db", map[string]any{"min_conns": 12, "max_conns": 10})
+	c.cache.Delete("search/db")
+	if v, err := c.Get(ctx, "search/db#min_conns"); err != nil || v.String() != "5" {
+		t.Fatalf("expected the last good value; got %v, %v", v, err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.As(err, &verr) || verr.Path != "search/db" || verr.Rule != "conns" || verr.Message == "" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the violation to be reported")
+	}
+
+	// Rules over several documents use the last good version of the other documents.
+	fake.put("search/db", map[string]any{"min_conns": 1, "max_conns": 4})
+	c.cache.Delete("search/db")
+	if v, err := c.Get(ctx, "search/db#max_conns"); err != nil || v.String() != "10" {
+		t.Fatalf("expected the update to violate the pool rule; got %v, %v", v, err)
+	}
+	if err := <-errs; !errors.As(err, &verr) || verr.Rule != "pool" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fake.put("search/app", map[string]any{"pool": 9, "tls": map[string]any{"enabled": true}})
+	c.cache.Delete("search/app")
+	if v, err := c.Get(ctx, "search/app#pool"); err != nil || v.String() != "8" {
+		t.Fatalf("expected the last good value; got %v, %v", v, err)
+	}
+}
+
+func TestValidationRuleCompileError(t *testing.T) {
+	fake := newFakeVault(t, map[string]map[string]any{"app": {"user": "a"}})
+	errs := make(chan error, 10)
+	c := new(fake.client(t), time.Minute, false,
+		WithErrorHandler(func(err error) { errs <- err }),
+		WithValidationRules(ValidationRule{Name: "broken", Documents: map[string]string{"app": "app"}, Expression: "app.user +"}),
+	)
+	defer c.Close()
+
+	if len(errs) != 1 {
+		t.Fatal("expected the compile error to be reported")
+	}
+	if _, err := c.Get(context.Background(), "app#user"); !errors.Is(err, ErrValidationFailed) {
+		t.Fatalf("expected a validation error; got %v", err)
+	}
+}